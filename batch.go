@@ -0,0 +1,54 @@
+package soap
+
+import (
+	"context"
+	"sync"
+)
+
+// BatchItem call of a batch
+type BatchItem struct {
+	SOAPAction string
+	Request    interface{}
+}
+
+// BatchResult outcome of the BatchItem at the same index
+type BatchResult struct {
+	Response []byte
+	Err      error
+}
+
+// CallBatch perform the independent calls of items with at most
+// concurrency of them in flight, over the connections shared by all calls
+// of the client. Results are returned in the order of items, each with its
+// own error; once ctx is done, calls in flight are abandoned and the items
+// not yet started fail with ctx.Err(). A concurrency below 1 means one.
+func (s *Client) CallBatch(ctx context.Context, items []BatchItem, concurrency int) []BatchResult {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > len(items) {
+		concurrency = len(items)
+	}
+	results := make([]BatchResult, len(items))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				if err := ctx.Err(); err != nil {
+					results[i].Err = err
+					continue
+				}
+				results[i].Response, results[i].Err = s.CallContext(ctx, items[i].SOAPAction, items[i].Request)
+			}
+		}()
+	}
+	for i := range items {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return results
+}
@@ -0,0 +1,84 @@
+package soap_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/sait/soapc"
+)
+
+func TestCallBatch(t *testing.T) {
+	var inFlight, maxInFlight int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		if r.Header.Get("SOAPAction") == "fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Write(b)
+	}))
+	defer ts.Close()
+
+	var items []BatchItem
+	for i := 0; i < 8; i++ {
+		action := "echo"
+		if i == 5 {
+			action = "fail"
+		}
+		items = append(items, BatchItem{SOAPAction: action, Request: testRequest{Message: fmt.Sprintf("message %d", i)}})
+	}
+	client := NewClient(ts.URL, false, nil)
+	results := client.CallBatch(context.Background(), items, 3)
+	if len(results) != len(items) {
+		t.Fatalf("want %d results, got %d", len(items), len(results))
+	}
+	for i, r := range results {
+		if i == 5 {
+			if r.Err == nil {
+				t.Errorf("item %d: want error", i)
+			}
+			continue
+		}
+		if r.Err != nil {
+			t.Errorf("item %d: %v", i, r.Err)
+		} else if want := fmt.Sprintf("<message>message %d</message>", i); !strings.Contains(string(r.Response), want) {
+			t.Errorf("item %d: want %s in\n%s", i, want, r.Response)
+		}
+	}
+	if max := atomic.LoadInt32(&maxInFlight); max > 3 {
+		t.Errorf("want at most 3 calls in flight, got %d", max)
+	}
+}
+
+func TestCallBatchCanceled(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(personEnvelope))
+	}))
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	client := NewClient(ts.URL, false, nil)
+	results := client.CallBatch(ctx, make([]BatchItem, 3), 2)
+	for i, r := range results {
+		if r.Err != context.Canceled {
+			t.Errorf("item %d: want context.Canceled, got %v", i, r.Err)
+		}
+	}
+}
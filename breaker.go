@@ -0,0 +1,144 @@
+package soap
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen returned without sending when the endpoint's breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// BreakerState circuit breaker state
+type BreakerState int
+
+// BreakerState values
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (b BreakerState) String() string {
+	switch b {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int(b))
+}
+
+// WithCircuitBreaker trip an endpoint's breaker after threshold consecutive
+// failures, failing calls fast with ErrCircuitOpen for cooldown. After the
+// cooldown a single trial call is let through; its outcome closes or
+// re-opens the breaker. Transport errors and 502, 503 and 504 responses
+// count as failures, SOAP faults do not, whatever their status, nor do
+// calls canceled or past the deadline of their context.
+func WithCircuitBreaker(threshold int, cooldown time.Duration) Option {
+	return func(c *Client) {
+		c.breaker = &breaker{
+			threshold: threshold,
+			cooldown:  cooldown,
+			endpoints: make(map[string]*endpointBreaker),
+		}
+	}
+}
+
+// BreakerState return the breaker state of the endpoint at url.
+// Clients without a circuit breaker always report BreakerClosed.
+func (s *Client) BreakerState(url string) BreakerState {
+	if s.breaker == nil {
+		return BreakerClosed
+	}
+	return s.breaker.state(url)
+}
+
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	endpoints map[string]*endpointBreaker
+}
+
+type endpointBreaker struct {
+	failures int
+	openedAt time.Time
+	open     bool
+	trial    bool
+}
+
+func (b *breaker) endpoint(url string) *endpointBreaker {
+	e, ok := b.endpoints[url]
+	if !ok {
+		e = &endpointBreaker{}
+		b.endpoints[url] = e
+	}
+	return e
+}
+
+func (b *breaker) state(url string) BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := b.endpoint(url)
+	switch {
+	case !e.open:
+		return BreakerClosed
+	case e.trial || time.Since(e.openedAt) >= b.cooldown:
+		return BreakerHalfOpen
+	}
+	return BreakerOpen
+}
+
+// allow return ErrCircuitOpen unless a call to url may proceed
+func (b *breaker) allow(url string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := b.endpoint(url)
+	if !e.open {
+		return nil
+	}
+	if e.trial || time.Since(e.openedAt) < b.cooldown {
+		return ErrCircuitOpen
+	}
+	e.trial = true
+	return nil
+}
+
+// record the outcome of a call to url allowed by allow
+func (b *breaker) record(url string, failed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := b.endpoint(url)
+	if !failed {
+		*e = endpointBreaker{}
+		return
+	}
+	e.failures++
+	if e.trial || e.failures >= b.threshold {
+		e.open = true
+		e.trial = false
+		e.openedAt = time.Now()
+	}
+}
+
+// abandon a call to url allowed by allow that ended without an outcome,
+// letting the next call be the trial
+func (b *breaker) abandon(url string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.endpoint(url).trial = false
+}
+
+// isBackendDown report whether status indicates the backend is unavailable
+func isBackendDown(status int) bool {
+	switch status {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,108 @@
+package soap_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/sait/soapc"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	var (
+		down int32 = 1
+		hits int32
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		if atomic.LoadInt32(&down) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(personEnvelope))
+	}))
+	defer ts.Close()
+
+	cooldown := 50 * time.Millisecond
+	client := NewClient(ts.URL, false, nil, WithCircuitBreaker(2, cooldown))
+	req := testRequest{Message: "test"}
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.Call("", req); err == nil || err == ErrCircuitOpen {
+			t.Fatalf("call %d: want HTTP error, got %v", i, err)
+		}
+	}
+	if state := client.BreakerState(ts.URL); state != BreakerOpen {
+		t.Fatalf("want %s, got %s", BreakerOpen, state)
+	}
+	if _, err := client.Call("", req); err != ErrCircuitOpen {
+		t.Fatalf("want ErrCircuitOpen, got %v", err)
+	}
+	if n := atomic.LoadInt32(&hits); n != 2 {
+		t.Errorf("want 2 requests reaching the server, got %d", n)
+	}
+
+	time.Sleep(cooldown)
+	if state := client.BreakerState(ts.URL); state != BreakerHalfOpen {
+		t.Fatalf("want %s, got %s", BreakerHalfOpen, state)
+	}
+	if _, err := client.Call("", req); err == nil || err == ErrCircuitOpen {
+		t.Fatalf("trial call: want HTTP error, got %v", err)
+	}
+	if state := client.BreakerState(ts.URL); state != BreakerOpen {
+		t.Fatalf("failed trial: want %s, got %s", BreakerOpen, state)
+	}
+
+	time.Sleep(cooldown)
+	atomic.StoreInt32(&down, 0)
+	if _, err := client.Call("", req); err != nil {
+		t.Fatal(err)
+	}
+	if state := client.BreakerState(ts.URL); state != BreakerClosed {
+		t.Fatalf("want %s, got %s", BreakerClosed, state)
+	}
+}
+
+func TestCircuitBreakerFaultAndCancel(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(faultEnvelope))
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	client := NewClient(ts.URL, false, nil, WithCircuitBreaker(1, time.Minute))
+	req := testRequest{Message: "test"}
+	for i := 0; i < 2; i++ {
+		if _, err := client.Call("", req); err == nil || err == ErrCircuitOpen {
+			t.Fatalf("call %d: want fault, got %v", i, err)
+		}
+	}
+	if state := client.BreakerState(ts.URL); state != BreakerClosed {
+		t.Errorf("faults on 503: want %s, got %s", BreakerClosed, state)
+	}
+
+	client = NewClient(ts.URL+"/slow", false, nil, WithCircuitBreaker(1, time.Minute))
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	if _, err := client.CallContext(ctx, "", req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("want context.Canceled, got %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.CallContext(ctx, "", req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("want context.DeadlineExceeded, got %v", err)
+	}
+	if state := client.BreakerState(ts.URL + "/slow"); state != BreakerClosed {
+		t.Errorf("caller's context ended: want %s, got %s", BreakerClosed, state)
+	}
+}
@@ -1,14 +1,29 @@
 package soap
 
 import (
+	"bufio"
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"net"
+	"html"
+	"io"
+	"log/slog"
+	"mime"
 	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 )
 
 // Envelope envelope
@@ -16,19 +31,376 @@ type Envelope struct {
 	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Envelope"`
 	Header  *Header  `xml:",omitempty"`
 	Body    Body
+	// BodyFirst marshal the Body before the Header, against the spec, for
+	// servers rejecting the standard order
+	BodyFirst bool `xml:"-"`
+	// Version SOAP version to marshal, 1.1 when unset. Under SOAP12 the
+	// Envelope, Header and Body take the 1.2 namespace, as does a Fault
+	// whose own Version is unset. Decoding sets it to SOAP12 for a 1.2
+	// envelope.
+	Version SOAPVersion `xml:"-"`
+}
+
+// MarshalXML marshal SOAPEnvelope, in the order set by BodyFirst
+func (e Envelope) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	type envelope Envelope
+	start.Name = e.XMLName
+	if start.Name.Local == "" {
+		start.Name = xml.Name{Space: envelopeNamespace, Local: "Envelope"}
+	}
+	if !e.BodyFirst && e.Version != SOAP12 {
+		return enc.EncodeElement(envelope(e), start)
+	}
+	space := envelopeNamespace
+	if e.Version == SOAP12 {
+		if e.XMLName.Local == "" {
+			start.Name.Space = envelope12Namespace
+		}
+		space = envelope12Namespace
+		if e.Body.Fault != nil && e.Body.Fault.Version == 0 {
+			fault := *e.Body.Fault
+			fault.Version = SOAP12
+			e.Body.Fault = &fault
+		}
+	}
+	if err := enc.EncodeToken(start); err != nil {
+		return err
+	}
+	encodeHeader := func() error {
+		if e.Header == nil {
+			return nil
+		}
+		return enc.EncodeElement(e.Header, xml.StartElement{Name: xml.Name{Space: space, Local: "Header"}})
+	}
+	if !e.BodyFirst {
+		if err := encodeHeader(); err != nil {
+			return err
+		}
+	}
+	if err := enc.EncodeElement(e.Body, xml.StartElement{Name: xml.Name{Space: space, Local: "Body"}}); err != nil {
+		return err
+	}
+	if e.BodyFirst {
+		if err := encodeHeader(); err != nil {
+			return err
+		}
+	}
+	return enc.EncodeToken(start.End())
 }
 
 // Header header
 type Header struct {
 	XMLName xml.Name    `xml:"http://schemas.xmlsoap.org/soap/envelope/ Header"`
 	Content interface{} `xml:",omitempty"`
+	// Unknown holds header blocks not matching Content, preserved so an
+	// intermediary can re-emit them unchanged on a forwarded request
+	Unknown []RawElement `xml:",omitempty"`
+	// Raw pre-serialized header blocks written verbatim after the others,
+	// e.g. signed ones forwarded opaquely. It is not set by decoding: see
+	// HeaderBytes.
+	Raw []byte `xml:",innerxml"`
+	// MaxBlocks number of header blocks decoding accepts before failing
+	// with ErrTooManyHeaderBlocks, DefaultMaxHeaderBlocks when zero
+	MaxBlocks int `xml:"-"`
+}
+
+// DefaultMaxHeaderBlocks header blocks decoded at most unless
+// Header.MaxBlocks says otherwise, far more than legitimate messages carry
+const DefaultMaxHeaderBlocks = 1000
+
+// ErrTooManyHeaderBlocks returned when decoding a header with more than
+// its MaxBlocks blocks, as a hostile peer could send to force work
+var ErrTooManyHeaderBlocks = errors.New("too many SOAP header blocks")
+
+// RawXML pre-serialized XML. Passed as the header of NewClient, it is
+// inserted verbatim into the Header of every request.
+type RawXML []byte
+
+// HeaderBytes return the content of the Header of the envelope in data as
+// is, nil when it has none. Prefixes declared on the Envelope are not
+// included.
+func HeaderBytes(data []byte) ([]byte, error) {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	if _, err := nextStart(d); err != nil {
+		return nil, err
+	}
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return nil, fmt.Errorf("failed to find SOAP header: %s", err.Error())
+		}
+		se, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if se.Name.Local != "Header" || (se.Name.Space != envelopeNamespace && se.Name.Space != envelope12Namespace) {
+			return nil, nil
+		}
+		start := d.InputOffset()
+		if err = d.Skip(); err != nil {
+			return nil, err
+		}
+		content := data[start:d.InputOffset()]
+		return content[:bytes.LastIndex(content, []byte("</"))], nil
+	}
+}
+
+// HeaderBytes return the content of the response Header as is, see
+// HeaderBytes
+func (r *Response) HeaderBytes() ([]byte, error) {
+	return HeaderBytes(r.Body)
+}
+
+// RawElement XML element preserved as its token stream
+type RawElement struct {
+	XMLName xml.Name
+	Tokens  []xml.Token
+}
+
+// MarshalXML re-emit the preserved tokens
+func (r RawElement) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	for _, token := range r.Tokens {
+		if err := e.EncodeToken(token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readRawElement capture the element opened by start, up to its end
+func readRawElement(d *xml.Decoder, start xml.StartElement) (RawElement, error) {
+	raw := RawElement{
+		XMLName: start.Name,
+		Tokens:  []xml.Token{rawStart(start)},
+	}
+	for depth := 1; depth > 0; {
+		token, err := d.Token()
+		if err != nil {
+			return raw, err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			token = rawStart(t)
+		case xml.EndElement:
+			depth--
+		default:
+			token = xml.CopyToken(t)
+		}
+		raw.Tokens = append(raw.Tokens, token)
+	}
+	return raw, nil
+}
+
+// rawStart copy start so that it survives re-encoding. Prefix declarations
+// are kept as literal attributes, since the encoder cannot emit xmlns-spaced
+// attributes and QName-valued content may still refer to them.
+func rawStart(start xml.StartElement) xml.StartElement {
+	se := xml.StartElement{Name: start.Name}
+	for _, attr := range start.Attr {
+		switch {
+		case attr.Name.Space == "xmlns":
+			attr.Name = xml.Name{Local: "xmlns:" + attr.Name.Local}
+		case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+			continue
+		}
+		se.Attr = append(se.Attr, attr)
+	}
+	return se
+}
+
+// xmlNameOf return the element name declared by v's XMLName field, if any
+func xmlNameOf(v interface{}) (name xml.Name, ok bool) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr || rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return
+	}
+	field, found := rv.Type().FieldByName("XMLName")
+	if !found || field.Type != reflect.TypeOf(xml.Name{}) {
+		return
+	}
+	tag := field.Tag.Get("xml")
+	if i := strings.Index(tag, ","); i >= 0 {
+		tag = tag[:i]
+	}
+	if tag != "" {
+		if i := strings.LastIndex(tag, " "); i >= 0 {
+			return xml.Name{Space: tag[:i], Local: tag[i+1:]}, true
+		}
+		return xml.Name{Local: tag}, true
+	}
+	name = rv.FieldByIndex(field.Index).Interface().(xml.Name)
+	return name, name.Local != ""
+}
+
+// matchName report whether element name satisfies expected, an empty
+// expected namespace matching any
+func matchName(expected, name xml.Name) bool {
+	return expected.Local == name.Local && (expected.Space == "" || expected.Space == name.Space)
 }
 
 // Body body
 type Body struct {
-	XMLName xml.Name    `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
-	Fault   *Fault      `xml:",omitempty"`
+	XMLName xml.Name `xml:"http://schemas.xmlsoap.org/soap/envelope/ Body"`
+	// Fault set by decoding when the body holds a fault, Content being set
+	// to nil: a body carrying both a fault and content, in either order,
+	// decodes as the fault, the content being skipped, or kept in Unknown
+	// under CaptureUnknown when it follows the fault.
+	Fault *Fault `xml:",omitempty"`
+	// Content operation element; fields tagged ",innerxml" receive mixed
+	// content, such as an embedded HTML fragment, verbatim. A pointer to a
+	// slice receives every body child matching its element's XMLName,
+	// appended in document order whatever prefix each one is written with.
+	// Optional fields declared as pointers tell present from absent: an
+	// element present but empty, <age></age> or <age/>, yields a pointer
+	// to the zero value, an absent one leaves the pointer nil.
 	Content interface{} `xml:",omitempty"`
+	// Unknown holds, when CaptureUnknown is set, the body children other
+	// than Content, re-emitted after it when encoding
+	Unknown []RawElement `xml:",omitempty"`
+	// FaultDetection how a body child is recognized as a fault when decoding
+	FaultDetection FaultDetection `xml:"-"`
+	// CaptureUnknown keep children not matching Content's XMLName, and
+	// any after the one decoded into Content, in Unknown instead of failing
+	// the decode, so elements added by a newer contract do not break it
+	CaptureUnknown bool `xml:"-"`
+	// Nil set by decoding when the content element is marked xsi:nil,
+	// an explicit absence of result rather than an empty one
+	Nil bool `xml:"-"`
+}
+
+// ErrNilContent returned by DecodeResponse and CallInto when the body
+// element is marked xsi:nil, the response body being left zero
+var ErrNilContent = errors.New("SOAP body content is xsi:nil")
+
+// isNil report whether an element with attrs is marked xsi:nil
+func isNil(attrs []xml.Attr) bool {
+	for _, attr := range attrs {
+		if attr.Name.Space == XSINamespace && attr.Name.Local == "nil" {
+			return attr.Value == "true" || attr.Value == "1"
+		}
+	}
+	return false
+}
+
+// FaultDetection fault recognition mode
+type FaultDetection int
+
+// FaultDetection values
+const (
+	// FaultDetectStrict recognize only a Fault in the namespace of the
+	// envelope carrying it, SOAP 1.1 or 1.2
+	FaultDetectStrict FaultDetection = iota
+	// FaultDetectTolerant also recognize the name in any letter case, in
+	// another SOAP envelope namespace version, with a trailing slash
+	// variation of one, or unqualified, for non-compliant servers
+	FaultDetectTolerant
+)
+
+// isFault report whether a child named name of a body in the envelope
+// namespace space is a fault under mode
+func (mode FaultDetection) isFault(name xml.Name, space string) bool {
+	if mode != FaultDetectTolerant {
+		return name.Space == space && name.Local == "Fault"
+	}
+	if !strings.EqualFold(name.Local, "Fault") {
+		return false
+	}
+	got := strings.TrimSuffix(strings.ToLower(name.Space), "/")
+	for _, ns := range []string{"", envelopeNamespace, envelope12Namespace} {
+		if got == strings.TrimSuffix(ns, "/") {
+			return true
+		}
+	}
+	return false
+}
+
+// WithFaultMapper turn detected faults into the error returned by calls
+// through mapper, e.g. to wrap them with context or map faultcodes to
+// sentinel errors. Without one, or when it returns nil, a fault is
+// returned as is: by CallStream as the *Fault, by the other calls as the
+// *HTTPError carrying it.
+func WithFaultMapper(mapper func(*Fault) error) Option {
+	return func(c *Client) {
+		c.faultMapper = mapper
+	}
+}
+
+// mapFault return the error for fault through the client's fault mapper,
+// err by default
+func (s *Client) mapFault(fault *Fault, err error) error {
+	if s.faultMapper != nil {
+		if mapped := s.faultMapper(fault); mapped != nil {
+			return mapped
+		}
+	}
+	return err
+}
+
+// WithFaultDetection recognize faults in responses according to mode
+func WithFaultDetection(mode FaultDetection) Option {
+	return func(c *Client) {
+		c.faultDetection = mode
+	}
+}
+
+// Element encode Content under Name instead of its own element name, so a
+// single Go type can be sent as different operation wrappers or namespaces
+// without mutating the type. Empty parts of Name are taken from Content's
+// XMLName. Use it as the request passed to Call:
+//
+//	client.Call(action, soap.Element{
+//		Name:    xml.Name{Space: "urn:example:ops", Local: "DoThing"},
+//		Content: req,
+//	})
+type Element struct {
+	Name    xml.Name
+	Content interface{}
+}
+
+// InNamespace return content as an Element in namespace, for calling one
+// operation type against environments with different target namespaces:
+//
+//	client.Call(action, soap.InNamespace(env.TargetNamespace, req))
+//
+// Only this request is affected; content's type keeps its own XMLName.
+func InNamespace(namespace string, content interface{}) Element {
+	return Element{Name: xml.Name{Space: namespace}, Content: content}
+}
+
+// WithOperationNamespaces encode the body of calls whose SOAPAction, compared
+// without surrounding quotes and whitespace, is a key of namespaces in the
+// namespace it maps to, as InNamespace does, e.g. from a table generated
+// from the WSDL. Requests already passed as an Element are left as is.
+func WithOperationNamespaces(namespaces map[string]string) Option {
+	return func(c *Client) {
+		if c.namespaces == nil {
+			c.namespaces = make(map[string]string, len(namespaces))
+		}
+		for action, ns := range namespaces {
+			c.namespaces[NormalizeSOAPAction(action)] = ns
+		}
+	}
+}
+
+// MarshalXML encode Content under the overriding name
+func (e Element) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	if name, ok := xmlNameOf(e.Content); ok {
+		start.Name = name
+	}
+	if e.Name.Local != "" {
+		start.Name.Local = e.Name.Local
+	}
+	if e.Name.Space != "" {
+		start.Name.Space = e.Name.Space
+	}
+	return enc.EncodeElement(e.Content, start)
 }
 
 // Fault fault
@@ -38,187 +410,2181 @@ type Fault struct {
 	String  string   `xml:"faultstring,omitempty"`
 	Actor   string   `xml:"faultactor,omitempty"`
 	Detail  string   `xml:"detail,omitempty"`
+	// CodeName Code with its prefix resolved against the namespace
+	// declarations in scope when the fault was decoded
+	CodeName xml.Name `xml:"-"`
+	// Reasons texts of a SOAP 1.2 fault reason, in document order; String
+	// holds the first
+	Reasons []FaultReason `xml:"-"`
+	// Version SOAP version of the fault structure, 1.1 when unset; set to
+	// SOAP12 when decoding a fault in the 1.2 namespace
+	Version SOAPVersion `xml:"-"`
+
+	// detail element as decoded, for DecodeDetail
+	detail *RawElement
+	// envelope namespace of the envelope the fault was decoded from
+	envelope string
 }
 
-func (f *Fault) Error() string {
-	return f.String
+// FaultReason SOAP 1.2 fault reason text in the language Lang
+type FaultReason struct {
+	Lang string
+	Text string
 }
 
-// NewClient return SOAP client
-func NewClient(url string, tls bool, header interface{}) *Client {
-	return &Client{
-		url:    url,
-		tls:    tls,
-		header: header,
+// Error return String, or when empty a message composed of Code and the
+// text of Detail, so that a fault is never reported blank
+func (f *Fault) Error() string {
+	if f.String != "" {
+		return f.String
+	}
+	message := "SOAP fault"
+	if f.Code != "" {
+		message += " " + f.Code
 	}
+	if detail := strings.Join(strings.Fields(f.Detail), " "); detail != "" {
+		message += ": " + detail
+	}
+	return message
 }
 
-// Client SOAP client
-type Client struct {
-	url       string
-	tls       bool
-	userAgent string
-	header    interface{}
+// Reason return the reason text best matching the language tag lang: an
+// exact match, then one sharing its primary language, e.g. "en-GB" for
+// "en-US", then the first text. String is returned for SOAP 1.1 faults.
+func (f *Fault) Reason(lang string) string {
+	if len(f.Reasons) == 0 {
+		return f.String
+	}
+	primary := func(tag string) string {
+		if i := strings.IndexAny(tag, "-_"); i >= 0 {
+			return tag[:i]
+		}
+		return tag
+	}
+	for _, r := range f.Reasons {
+		if strings.EqualFold(r.Lang, lang) {
+			return r.Text
+		}
+	}
+	for _, r := range f.Reasons {
+		if strings.EqualFold(primary(r.Lang), primary(lang)) {
+			return r.Text
+		}
+	}
+	return f.Reasons[0].Text
 }
 
-func dialTimeout(network, addr string) (net.Conn, error) {
-	timeout := time.Duration(30 * time.Second)
-	return net.DialTimeout(network, addr, timeout)
+// fault12Codes SOAP 1.2 fault codes, keyed by their SOAP 1.1 counterpart
+var fault12Codes = map[string]string{
+	"Client":              "Sender",
+	"Server":              "Receiver",
+	"Sender":              "Sender",
+	"Receiver":            "Receiver",
+	"MustUnderstand":      "MustUnderstand",
+	"VersionMismatch":     "VersionMismatch",
+	"DataEncodingUnknown": "DataEncodingUnknown",
 }
 
-// UnmarshalXML unmarshal SOAPHeader
-func (h *Header) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	var (
-		token xml.Token
-		err   error
-	)
-Loop:
-	for {
-		if token, err = d.Token(); err != nil {
+// MarshalXML marshal SOAPFault in the structure of its Version. A SOAP 1.2
+// fault carries Code as Code/Value, the 1.1 Client and Server codes mapped
+// to Sender and Receiver, Reasons, or String in English, as Reason/Text,
+// Actor as Node and Detail as Detail.
+func (f Fault) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	type fault Fault
+	if f.Version != SOAP12 {
+		start.Name = xml.Name{Space: envelopeNamespace, Local: "Fault"}
+		return e.EncodeElement(fault(f), start)
+	}
+	name := func(local string) xml.Name {
+		return xml.Name{Space: envelope12Namespace, Local: local}
+	}
+	start = xml.StartElement{
+		Name: name("Fault"),
+		Attr: []xml.Attr{{Name: xml.Name{Local: "xmlns:env"}, Value: envelope12Namespace}},
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+
+	code := strings.TrimSpace(f.Code)
+	local := code
+	if i := strings.Index(code, ":"); i >= 0 && (f.CodeName.Space == "" || f.CodeName.Space == envelopeNamespace || f.CodeName.Space == envelope12Namespace) {
+		local = code[i+1:]
+	}
+	if mapped, ok := fault12Codes[local]; ok {
+		code = "env:" + mapped
+	}
+	type value struct {
+		Value string `xml:"http://www.w3.org/2003/05/soap-envelope Value"`
+	}
+	if err := e.EncodeElement(value{code}, xml.StartElement{Name: name("Code")}); err != nil {
+		return err
+	}
+
+	reasons := f.Reasons
+	if len(reasons) == 0 {
+		reasons = []FaultReason{{Lang: "en", Text: f.String}}
+	}
+	reason := xml.StartElement{Name: name("Reason")}
+	if err := e.EncodeToken(reason); err != nil {
+		return err
+	}
+	for _, r := range reasons {
+		text := xml.StartElement{
+			Name: name("Text"),
+			Attr: []xml.Attr{{Name: xml.Name{Local: "xml:lang"}, Value: r.Lang}},
+		}
+		if err := e.EncodeElement(r.Text, text); err != nil {
 			return err
 		}
-		if token == nil {
-			break
+	}
+	if err := e.EncodeToken(reason.End()); err != nil {
+		return err
+	}
+
+	if f.Actor != "" {
+		if err := e.EncodeElement(f.Actor, xml.StartElement{Name: name("Node")}); err != nil {
+			return err
 		}
-		switch se := token.(type) {
-		case xml.StartElement:
-			if err = d.DecodeElement(h.Content, &se); err != nil {
-				return err
-			}
-		case xml.EndElement:
-			break Loop
+	}
+	if f.Detail != "" {
+		if err := e.EncodeElement(f.Detail, xml.StartElement{Name: name("Detail")}); err != nil {
+			return err
 		}
 	}
-	return nil
+	return e.EncodeToken(start.End())
 }
 
-// UnmarshalXML unmarshal SOAPBody
-func (b *Body) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
-	if b.Content == nil {
-		return xml.UnmarshalError("Content must be a pointer to a struct")
+// UnmarshalXML unmarshal SOAPFault
+func (f *Fault) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return f.decode(d, start, nil)
+}
+
+// decode unmarshal SOAPFault within the namespace declarations of its
+// ancestors. The children of a SOAP 1.2 fault are mapped to their 1.1
+// counterparts: Code/Value to Code, the first Reason/Text to String, Node
+// to Actor and Detail to Detail.
+func (f *Fault) decode(d *xml.Decoder, start xml.StartElement, ns namespaces) error {
+	return f.decodeWith(d, start, ns, nil)
+}
+
+// decodeWith decode SOAPFault, handing its detail to onDetail, when set,
+// as it is read
+func (f *Fault) decodeWith(d *xml.Decoder, start xml.StartElement, ns namespaces, onDetail func(*Fault, io.Reader) error) error {
+	f.XMLName = start.Name
+	if start.Name.Space == envelope12Namespace {
+		f.Version = SOAP12
 	}
-	var (
-		token    xml.Token
-		err      error
-		consumed bool
-	)
-Loop:
+	ns = ns.with(start.Attr)
 	for {
-		if token, err = d.Token(); err != nil {
+		token, err := d.Token()
+		if err != nil {
 			return err
 		}
-		if token == nil {
-			break
-		}
-		envelopeNameSpace := "http://schemas.xmlsoap.org/soap/envelope/"
 		switch se := token.(type) {
 		case xml.StartElement:
-			if consumed {
-				return xml.UnmarshalError(
-					"Found multiple elements inside SOAP body; not wrapped-document/literal WS-I compliant")
-			} else if se.Name.Space == envelopeNameSpace && se.Name.Local == "Fault" {
-				b.Fault = &Fault{}
-				b.Content = nil
-				err = d.DecodeElement(b.Fault, &se)
-				if err != nil {
-					return err
+			switch se.Name.Local {
+			case "faultcode":
+				if err = d.DecodeElement(&f.Code, &se); err == nil {
+					f.CodeName = ns.with(se.Attr).resolve(strings.TrimSpace(f.Code))
 				}
-				consumed = true
-			} else {
-				if err = d.DecodeElement(b.Content, &se); err != nil {
-					return err
+			case "faultstring":
+				err = d.DecodeElement(&f.String, &se)
+			case "faultactor":
+				err = d.DecodeElement(&f.Actor, &se)
+			case "detail", "Detail":
+				if onDetail != nil {
+					err = f.streamDetail(d, onDetail)
+				} else {
+					err = f.decodeDetail(d, se)
 				}
-				consumed = true
+			case "Code":
+				err = f.decodeCode(d, ns.with(se.Attr))
+			case "Reason":
+				err = f.decodeReason(d)
+			case "Node":
+				err = d.DecodeElement(&f.Actor, &se)
+			default:
+				err = d.Skip()
+			}
+			if err != nil {
+				return err
 			}
 		case xml.EndElement:
-			break Loop
+			return nil
+		}
+	}
+}
+
+// decodeDetail keep the detail element for DecodeDetail, its text in Detail
+func (f *Fault) decodeDetail(d *xml.Decoder, start xml.StartElement) error {
+	raw, err := readRawElement(d, start)
+	if err != nil {
+		return err
+	}
+	data, err := xml.Marshal(raw)
+	if err != nil {
+		return err
+	}
+	f.detail = &raw
+	return xml.Unmarshal(data, &f.Detail)
+}
+
+// streamDetail hand the detail being read by d to onDetail, skipping
+// whatever it leaves unread
+func (f *Fault) streamDetail(d *xml.Decoder, onDetail func(*Fault, io.Reader) error) error {
+	r := &chardataReader{d: d, depth: 1}
+	if err := onDetail(f, r); err != nil {
+		return err
+	}
+	for r.depth > 0 {
+		r.buf = r.buf[:0]
+		if err := r.next(); err != nil {
+			return err
 		}
 	}
 	return nil
 }
 
-// Call SOAP client API call
-func (s *Client) Call(soapAction string, request interface{}) (response []byte, err error) {
-	var envelope Envelope
-	if s.header != nil {
-		envelope = Envelope{
-			Header: &Header{
-				Content: s.header,
-			},
-			Body: Body{
-				Content: request,
-			},
+// chardataReader read the character data of the element being decoded by
+// d, up to its end, as it is parsed
+type chardataReader struct {
+	d     *xml.Decoder
+	depth int
+	buf   []byte
+}
+
+func (r *chardataReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.depth == 0 {
+			return 0, io.EOF
 		}
-	} else {
-		envelope = Envelope{
-			Body: Body{
-				Content: request,
-			},
+		if err := r.next(); err != nil {
+			return 0, err
 		}
 	}
-	response, err = s.CallRaw(soapAction, envelope, nil)
-	return
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
 }
 
-func (s *Client) CallRaw(soapAction string, request interface{}, httpHeaders map[string]string) (response []byte, err error) {
-	buffer := new(bytes.Buffer)
-	buffer.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
-	encoder := xml.NewEncoder(buffer)
-	// encoder.Indent("  ", "    ")
-	if err = encoder.Encode(request); err != nil {
-		err = fmt.Errorf("failed to encode envelope: %s", err.Error())
-		return
-	}
-	if err = encoder.Flush(); err != nil {
-		err = fmt.Errorf("failed to flush encoder: %s", err.Error())
-		return
-	}
-	req, err := http.NewRequest("POST", s.url, buffer)
+// next read the next token, buffering its character data
+func (r *chardataReader) next() error {
+	token, err := r.d.Token()
 	if err != nil {
-		err = fmt.Errorf("failed to create POST request: %s", err.Error())
-		return
+		return err
 	}
-	req.Header.Add("Content-Type", "text/xml; charset=\"utf-8\"")
-	req.Header.Set("SOAPAction", soapAction)
-	req.Header.Set("Content-Length", string(buffer.Len()))
-	req.Header.Set("User-Agent", s.userAgent)
-	for key, value := range httpHeaders {
-		req.Header.Set(key, value)
+	switch t := token.(type) {
+	case xml.StartElement:
+		r.depth++
+	case xml.EndElement:
+		r.depth--
+	case xml.CharData:
+		r.buf = append(r.buf, t...)
 	}
-	req.Close = true
+	return nil
+}
 
-	tr := &http.Transport{
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: s.tls,
-		},
-		Dial: dialTimeout,
+// DecodeDetail decode the first element within the fault detail, such as
+// a namespace qualified <ns:ErrorInfo>, into v. Prefixes declared outside
+// the detail are resolved as they were in the response.
+func (f *Fault) DecodeDetail(v interface{}) error {
+	if f.detail == nil {
+		return errors.New("fault has no detail")
 	}
-
-	client := &http.Client{Transport: tr}
-	res, err := client.Do(req)
+	data, err := xml.Marshal(f.detail)
 	if err != nil {
-		err = fmt.Errorf("failed to send SOAP request: %s", err.Error())
-		return
+		return err
 	}
-	defer res.Body.Close()
-
-	if res.StatusCode != http.StatusOK {
-		soapFault, errr := ioutil.ReadAll(res.Body)
-		if errr != nil {
-			err = fmt.Errorf("failed to read SOAP fault response body: %s", errr.Error())
-			return
+	d := xml.NewDecoder(bytes.NewReader(data))
+	if _, err := d.Token(); err != nil {
+		return err
+	}
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch se := token.(type) {
+		case xml.StartElement:
+			return d.DecodeElement(v, &se)
+		case xml.EndElement:
+			return errors.New("fault detail has no element")
 		}
-		err = fmt.Errorf("HTTP Status Code: %d, SOAP Fault: \n%s", res.StatusCode, string(soapFault))
-		return
 	}
+}
 
-	response, err = ioutil.ReadAll(res.Body)
-	if err != nil {
-		err = fmt.Errorf("failed to read SOAP body: %s", err.Error())
-		return
-	}
-	if len(response) == 0 {
-		return
+// DecodeEscapedDetail decode the XML a fault detail carries as escaped
+// text, rather than as nested elements, into v. See DecodeEscaped.
+func (f *Fault) DecodeEscapedDetail(v interface{}) error {
+	return DecodeEscaped(f.Detail, v)
+}
+
+// maxUnescape levels of escaping DecodeEscaped undoes
+const maxUnescape = 3
+
+// DecodeEscaped decode the first element of the XML document text holds,
+// such as a faultstring or detail text, into v. text is unescaped as many
+// times as needed, up to 3, to start with markup, so XML escaped once more
+// than its enclosing document, e.g. &amp;lt;Error&amp;gt; on the wire, is
+// decoded as well.
+func DecodeEscaped(text string, v interface{}) error {
+	for i := 0; !strings.HasPrefix(strings.TrimSpace(text), "<"); i++ {
+		if i == maxUnescape || !strings.Contains(text, "&") {
+			return errors.New("text holds no XML element")
+		}
+		text = html.UnescapeString(text)
 	}
-	return
+	return xml.Unmarshal([]byte(text), v)
+}
+
+// decodeCode decode the Value of a SOAP 1.2 fault Code, skipping subcodes
+func (f *Fault) decodeCode(d *xml.Decoder, ns namespaces) error {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch se := token.(type) {
+		case xml.StartElement:
+			if se.Name.Local == "Value" {
+				if err = d.DecodeElement(&f.Code, &se); err == nil {
+					f.CodeName = ns.with(se.Attr).resolve(strings.TrimSpace(f.Code))
+				}
+			} else {
+				err = d.Skip()
+			}
+			if err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// xmlNamespace namespace bound to the xml prefix, that of xml:lang
+const xmlNamespace = "http://www.w3.org/XML/1998/namespace"
+
+// decodeReason decode the Text elements of a SOAP 1.2 fault Reason
+func (f *Fault) decodeReason(d *xml.Decoder) error {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch se := token.(type) {
+		case xml.StartElement:
+			if se.Name.Local != "Text" {
+				if err = d.Skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			var reason FaultReason
+			for _, attr := range se.Attr {
+				if attr.Name.Space == xmlNamespace && attr.Name.Local == "lang" {
+					reason.Lang = attr.Value
+				}
+			}
+			if err = d.DecodeElement(&reason.Text, &se); err != nil {
+				return err
+			}
+			if len(f.Reasons) == 0 && f.String == "" {
+				f.String = reason.Text
+			}
+			f.Reasons = append(f.Reasons, reason)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// SOAP envelope namespaces
+const (
+	envelopeNamespace   = "http://schemas.xmlsoap.org/soap/envelope/"
+	envelope12Namespace = "http://www.w3.org/2003/05/soap-envelope"
+)
+
+// envelopeSpace return space when it is a SOAP envelope namespace, the
+// SOAP 1.1 one otherwise
+func envelopeSpace(space string) string {
+	if space == envelope12Namespace {
+		return space
+	}
+	return envelopeNamespace
+}
+
+// checkEnvelope return an error unless start is a SOAP 1.1 or 1.2 Envelope
+func checkEnvelope(start xml.StartElement) error {
+	if start.Name.Local != "Envelope" {
+		return xml.UnmarshalError("expected element type <Envelope> but have <" + start.Name.Local + ">")
+	}
+	if start.Name.Space != envelopeNamespace && start.Name.Space != envelope12Namespace {
+		return xml.UnmarshalError("unknown SOAP envelope namespace \"" + start.Name.Space + "\"")
+	}
+	return nil
+}
+
+// namespaces prefix to namespace bindings in scope, "" keying the default
+type namespaces map[string]string
+
+// with return ns extended by the declarations among attrs
+func (ns namespaces) with(attrs []xml.Attr) namespaces {
+	var scope namespaces
+	for _, attr := range attrs {
+		var prefix string
+		switch {
+		case attr.Name.Space == "xmlns":
+			prefix = attr.Name.Local
+		case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+		default:
+			continue
+		}
+		if scope == nil {
+			scope = make(namespaces, len(ns)+1)
+			for k, v := range ns {
+				scope[k] = v
+			}
+		}
+		scope[prefix] = attr.Value
+	}
+	if scope == nil {
+		return ns
+	}
+	return scope
+}
+
+// resolve QName value qname; as with element names, an undeclared prefix
+// is kept as the namespace
+func (ns namespaces) resolve(qname string) xml.Name {
+	prefix, local := "", qname
+	if i := strings.Index(qname, ":"); i >= 0 {
+		prefix, local = qname[:i], qname[i+1:]
+	}
+	if space, ok := ns[prefix]; ok {
+		return xml.Name{Space: space, Local: local}
+	}
+	return xml.Name{Space: prefix, Local: local}
+}
+
+// HTTPError non-200 response. Fault is set when the body carries a SOAP
+// fault, which errors.As also reaches through Unwrap.
+type HTTPError struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	Fault      *Fault
+	// URL endpoint that answered with StatusCode
+	URL string
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("HTTP Status Code: %d, SOAP Fault: \n%s", e.StatusCode, string(e.Body))
+}
+
+// Unwrap return the SOAP fault, if any
+func (e *HTTPError) Unwrap() error {
+	if e.Fault == nil {
+		return nil
+	}
+	return e.Fault
+}
+
+// parseFault return the SOAP fault carried by envelope data, if any
+func parseFault(data []byte, mode FaultDetection) *Fault {
+	envelope := Envelope{
+		Body: Body{
+			Content:        &struct{}{},
+			FaultDetection: mode,
+		},
+	}
+	if checkDTD(data) != nil {
+		return nil
+	}
+	if err := xml.Unmarshal(data, &envelope); err != nil {
+		return nil
+	}
+	return envelope.Body.Fault
+}
+
+// DecodeResponse decode the envelope read from r, e.g. a SOAP message
+// delivered by a message queue, into respHeader and respBody, pointers to
+// the expected header block and body element. Either may be nil when not
+// needed; header blocks not matching respHeader are skipped. A fault in
+// the body is returned as a *Fault. SOAP 1.1 and 1.2 envelopes are both
+// accepted.
+func DecodeResponse(r io.Reader, respHeader, respBody interface{}) error {
+	return decodeResponse(r, respHeader, respBody, FaultDetectStrict)
+}
+
+// decodeResponse DecodeResponse recognizing faults according to mode
+func decodeResponse(r io.Reader, respHeader, respBody interface{}, mode FaultDetection) error {
+	if respBody == nil {
+		respBody = &struct{}{}
+	}
+	envelope := Envelope{
+		Body: Body{
+			Content:        respBody,
+			FaultDetection: mode,
+		},
+	}
+	if respHeader != nil {
+		envelope.Header = &Header{
+			Content: respHeader,
+		}
+	}
+	d := xml.NewDecoder(r)
+	start, err := nextStart(d)
+	if err != nil {
+		return err
+	}
+	if err = d.DecodeElement(&envelope, &start); err != nil {
+		return fmt.Errorf("failed to decode SOAP envelope: %w", err)
+	}
+	if envelope.Body.Fault != nil {
+		return envelope.Body.Fault
+	}
+	if envelope.Body.Nil {
+		return ErrNilContent
+	}
+	return nil
+}
+
+// Option configure Client
+type Option func(*Client)
+
+// OnWarning register a function called whenever the client applies a
+// compatibility workaround to a non-compliant response
+func OnWarning(f func(Warning)) Option {
+	return func(c *Client) {
+		c.onWarning = f
+	}
+}
+
+// OnEnvelope register a function called with every envelope assembled by
+// the client, header blocks and token included, right before it is
+// encoded, e.g. to set a field computed over the whole request. f may
+// modify the envelope and its Header, which are copies, but must replace
+// rather than modify the Content values they point to, which belong to the
+// caller. An error from f fails the call. It is called again when a call
+// is resent with a refreshed token, not when an attempt is retried.
+func OnEnvelope(f func(*Envelope) error) Option {
+	return func(c *Client) {
+		c.onEnvelope = f
+	}
+}
+
+// OnResponseBody register a function called with the status and the whole
+// body of every response read by the client, successful or not, once
+// decompressed and within the maximum response size. The body is read
+// once and shared with decoding and fault parsing, so f must not modify
+// it. Bodies left unread, by CallStream or SkipResponseBody, are not
+// passed.
+func OnResponseBody(f func(statusCode int, body []byte)) Option {
+	return func(c *Client) {
+		c.onResponseBody = f
+	}
+}
+
+// NewClient return SOAP client
+func NewClient(url string, tls bool, header interface{}, opts ...Option) *Client {
+	c := &Client{
+		url:          url,
+		tls:          tls,
+		header:       header,
+		maxRedirects: defaultMaxRedirects,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Client SOAP client
+type Client struct {
+	url       string
+	tls       bool
+	userAgent string
+	header    interface{}
+	headers   map[string]string
+	onWarning func(Warning)
+	breaker   *breaker
+	reliable  *ReliableSequence
+
+	onResponseBody func(int, []byte)
+	onEnvelope     func(*Envelope) error
+
+	retryAttempts int
+	retryBackoff  time.Duration
+	retryNonFault bool
+
+	timeout         time.Duration
+	actionTimeouts  map[string]time.Duration
+	readIdleTimeout time.Duration
+
+	maxRedirects     int
+	insecureRedirect bool
+
+	tokens *tokenCache
+
+	logger    *slog.Logger
+	logLevels *LogLevels
+
+	socket            *SocketOptions
+	unixSocket        string
+	keepAlive         time.Duration
+	keepAliveInterval time.Duration
+	dscp              int
+
+	multipartBoundary func() string
+
+	encryption *BodyEncryption
+
+	clientOnce sync.Once
+	client     *http.Client
+
+	faultDetection    FaultDetection
+	faultMapper       func(*Fault) error
+	faultDetail       func(*Fault, io.Reader) error
+	contentTypeAction bool
+	requireAction     bool
+	matchAction       bool
+	bodyFirst         bool
+	connection        string
+	resolveURL        func(string, interface{}) (string, error)
+	namespaces        map[string]string
+	acceptCharset     string
+	requireUTF8       bool
+	compressRequests  bool
+	identityEncoding  bool
+	sniffGzip         bool
+	keepBOM           bool
+	compressThreshold int
+	trailer           string
+	crlf              bool
+	procInsts         []xml.ProcInst
+	zeroBuffers       bool
+	successStatus     map[int]bool
+	digest            *bodyDigest
+	maxResponseSize   int64
+	emptyElements     EmptyElementForm
+	invalidUTF8       InvalidUTF8Handling
+	skipBody          bool
+
+	rootCAs           *x509.CertPool
+	skipHostnameCheck bool
+	verifyConnection  func(tls.ConnectionState) error
+	clientCertificate func(*tls.CertificateRequestInfo) (*tls.Certificate, error)
+}
+
+// Warning compatibility workaround applied by the client
+type Warning struct {
+	Code    string
+	Message string
+}
+
+// Warning codes
+const (
+	// WarningGzipNotCompressed body labelled gzip was passed through as is
+	WarningGzipNotCompressed = "gzip-not-compressed"
+	// WarningGzipUnadvertised gzip body without Content-Encoding was
+	// decompressed by WithGzipSniffing
+	WarningGzipUnadvertised = "gzip-unadvertised"
+	// WarningNonStandardFault fault recognized only by tolerant detection
+	WarningNonStandardFault = "non-standard-fault"
+	// WarningLeadingComment comments precede the envelope
+	WarningLeadingComment = "leading-comment"
+	// WarningUndeclaredEncoding body is not UTF-8 yet declares no encoding
+	WarningUndeclaredEncoding = "undeclared-encoding"
+)
+
+func (s *Client) warn(code, message string) {
+	if s.onWarning != nil {
+		s.onWarning(Warning{Code: code, Message: message})
+	}
+}
+
+// inspect warn about oddities of response body that are coped with silently
+func (s *Client) inspect(body []byte) {
+	if s.onWarning == nil {
+		return
+	}
+	if !utf8.Valid(body) && !declaresEncoding(body) {
+		s.warn(WarningUndeclaredEncoding, "response is not valid UTF-8 and declares no encoding")
+	}
+	d := xml.NewDecoder(bytes.NewReader(body))
+	for {
+		token, err := d.RawToken()
+		if err != nil {
+			return
+		}
+		switch token.(type) {
+		case xml.Comment:
+			s.warn(WarningLeadingComment, "comment precedes the SOAP envelope")
+			return
+		case xml.StartElement:
+			return
+		}
+	}
+}
+
+// inspectFault warn when fault was recognized only by tolerant detection
+func (s *Client) inspectFault(fault *Fault) {
+	if fault != nil {
+		s.logFault(fault)
+	}
+	if fault != nil && !FaultDetectStrict.isFault(fault.XMLName, envelopeSpace(fault.envelope)) {
+		s.warn(WarningNonStandardFault, fmt.Sprintf("non-standard fault element {%s}%s",
+			fault.XMLName.Space, fault.XMLName.Local))
+	}
+}
+
+// declaresEncoding report whether body starts with an XML declaration
+// naming an encoding
+func declaresEncoding(body []byte) bool {
+	if !bytes.HasPrefix(body, []byte("<?xml")) {
+		return false
+	}
+	end := bytes.Index(body, []byte("?>"))
+	return end > 0 && bytes.Contains(body[:end], []byte("encoding"))
+}
+
+// declaredEncoding return the encoding named by the XML declaration
+// body starts with, if any
+func declaredEncoding(body []byte) string {
+	if !declaresEncoding(body) {
+		return ""
+	}
+	decl := body[:bytes.Index(body, []byte("?>"))]
+	decl = decl[bytes.Index(decl, []byte("encoding"))+len("encoding"):]
+	decl = bytes.TrimLeft(decl, " \t\r\n=")
+	if len(decl) == 0 || (decl[0] != '"' && decl[0] != '\'') {
+		return ""
+	}
+	if end := bytes.IndexByte(decl[1:], decl[0]); end >= 0 {
+		return string(decl[1 : end+1])
+	}
+	return ""
+}
+
+// WithAcceptCharset send charset, e.g. "utf-8", as the Accept-Charset of
+// every request
+func WithAcceptCharset(charset string) Option {
+	return func(c *Client) {
+		c.acceptCharset = charset
+	}
+}
+
+// RequireUTF8 fail calls whose response is not UTF-8 with an error
+// wrapping ErrNotUTF8, rather than decoding another charset: the charset
+// of the Content-Type and the encoding of the XML declaration must be
+// UTF-8 when present, and the body valid UTF-8. Accept-Charset: utf-8 is
+// sent unless WithAcceptCharset sets another value.
+func RequireUTF8() Option {
+	return func(c *Client) {
+		c.requireUTF8 = true
+		if c.acceptCharset == "" {
+			c.acceptCharset = "utf-8"
+		}
+	}
+}
+
+// ErrNotUTF8 wrapped by the error of a response rejected by RequireUTF8
+var ErrNotUTF8 = errors.New("SOAP response is not UTF-8")
+
+// checkUTF8 return an error wrapping ErrNotUTF8 unless the response body
+// of contentType is UTF-8
+func checkUTF8(contentType string, body []byte) error {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if charset, ok := params["charset"]; ok && !isUTF8Label(charset) {
+			return fmt.Errorf("%w: Content-Type charset %s", ErrNotUTF8, charset)
+		}
+	}
+	if encoding := declaredEncoding(body); encoding != "" && !isUTF8Label(encoding) {
+		return fmt.Errorf("%w: declared encoding %s", ErrNotUTF8, encoding)
+	}
+	if !utf8.Valid(body) {
+		return fmt.Errorf("%w: invalid UTF-8 bytes", ErrNotUTF8)
+	}
+	return nil
+}
+
+// isUTF8Label report whether the charset label names UTF-8
+func isUTF8Label(label string) bool {
+	return strings.EqualFold(label, "utf-8") || strings.EqualFold(label, "utf8")
+}
+
+// httpClient return the HTTP client shared by all calls, created on first
+// use so connections are reused across calls
+func (s *Client) httpClient() *http.Client {
+	s.clientOnce.Do(func() {
+		tr := &http.Transport{
+			TLSClientConfig:    s.tlsConfig(),
+			DialContext:        s.dial,
+			DisableCompression: s.identityEncoding,
+		}
+		s.client = &http.Client{Transport: tr, CheckRedirect: s.checkRedirect}
+	})
+	return s.client
+}
+
+// UnmarshalXML unmarshal SOAPEnvelope, handing down namespace declarations
+// so that QName values such as faultcode can be resolved. Both SOAP 1.1
+// and 1.2 envelopes are accepted, Version being set to SOAP12 for the
+// latter; Header and Body must be in the namespace of the Envelope.
+func (e *Envelope) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	if err := checkEnvelope(start); err != nil {
+		return err
+	}
+	e.XMLName = start.Name
+	space := start.Name.Space
+	if space == envelope12Namespace {
+		e.Version = SOAP12
+	}
+	ns := namespaces(nil).with(start.Attr)
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch se := token.(type) {
+		case xml.StartElement:
+			switch {
+			case se.Name.Space == space && se.Name.Local == "Header":
+				if e.Header == nil {
+					e.Header = &Header{}
+				}
+				err = d.DecodeElement(e.Header, &se)
+			case se.Name.Space == space && se.Name.Local == "Body":
+				err = e.Body.decode(d, se, ns)
+			default:
+				err = d.Skip()
+			}
+			if err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// UnmarshalXML unmarshal SOAPHeader.
+// Blocks matching Content's XMLName, or every block when Content declares
+// none, are decoded into Content; the others are kept in Unknown.
+func (h *Header) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var (
+		token xml.Token
+		err   error
+	)
+	expected, named := xmlNameOf(h.Content)
+	limit := h.MaxBlocks
+	if limit <= 0 {
+		limit = DefaultMaxHeaderBlocks
+	}
+	blocks := 0
+Loop:
+	for {
+		if token, err = d.Token(); err != nil {
+			return err
+		}
+		if token == nil {
+			break
+		}
+		switch se := token.(type) {
+		case xml.StartElement:
+			if blocks++; blocks > limit {
+				return ErrTooManyHeaderBlocks
+			}
+			if h.Content == nil || (named && !matchName(expected, se.Name)) {
+				raw, err := readRawElement(d, se)
+				if err != nil {
+					return err
+				}
+				h.Unknown = append(h.Unknown, raw)
+				continue
+			}
+			if err = d.DecodeElement(h.Content, &se); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			break Loop
+		}
+	}
+	return nil
+}
+
+// UnmarshalXML unmarshal SOAPBody
+func (b *Body) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	return b.decode(d, start, nil)
+}
+
+// decode unmarshal SOAPBody within the namespace declarations of its ancestors
+func (b *Body) decode(d *xml.Decoder, start xml.StartElement, ns namespaces) error {
+	if b.Content == nil {
+		return xml.UnmarshalError("Content must be a pointer to a struct")
+	}
+	var (
+		token    xml.Token
+		err      error
+		consumed bool
+	)
+	list := sliceOf(b.Content)
+	expected, named := xmlNameOf(b.Content)
+	if list.IsValid() {
+		expected, named = xmlNameOf(reflect.New(list.Type().Elem()).Interface())
+	}
+	ns = ns.with(start.Attr)
+	space := envelopeSpace(start.Name.Space)
+Loop:
+	for {
+		if token, err = d.Token(); err != nil {
+			return err
+		}
+		if token == nil {
+			break
+		}
+		switch se := token.(type) {
+		case xml.StartElement:
+			fault := b.FaultDetection.isFault(se.Name, space)
+			switch {
+			case fault && b.Fault == nil:
+				// a fault makes the response a fault whatever the order of
+				// the elements, content decoded before being dropped
+				b.Fault = &Fault{envelope: space}
+				b.Content = nil
+				if err = b.Fault.decode(d, se, ns); err != nil {
+					return err
+				}
+				consumed = true
+			case b.CaptureUnknown && !fault && (consumed || (named && !matchName(expected, se.Name))):
+				raw, err := readRawElement(d, se)
+				if err != nil {
+					return err
+				}
+				b.Unknown = append(b.Unknown, raw)
+			case b.Fault != nil && !fault:
+				if err = d.Skip(); err != nil {
+					return err
+				}
+			case consumed:
+				return xml.UnmarshalError(
+					"Found multiple elements inside SOAP body; not wrapped-document/literal WS-I compliant")
+			case list.IsValid():
+				item := reflect.New(list.Type().Elem())
+				if err = d.DecodeElement(item.Interface(), &se); err != nil {
+					return err
+				}
+				list.Set(reflect.Append(list, item.Elem()))
+			default:
+				if err = d.DecodeElement(b.Content, &se); err != nil {
+					return err
+				}
+				b.Nil = isNil(se.Attr)
+				consumed = true
+			}
+		case xml.EndElement:
+			break Loop
+		}
+	}
+	return nil
+}
+
+// sliceOf return the slice v points to, the zero Value when it is not a
+// pointer to a slice of elements
+func sliceOf(v interface{}) reflect.Value {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return reflect.Value{}
+	}
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Slice || rv.Type().Elem().Kind() == reflect.Uint8 {
+		return reflect.Value{}
+	}
+	return rv
+}
+
+// Call SOAP client API call
+func (s *Client) Call(soapAction string, request interface{}) (response []byte, err error) {
+	res, err := s.call(context.Background(), soapAction, request)
+	if err != nil {
+		return
+	}
+	response = res.Body
+	return
+}
+
+// CallFault SOAP client API call returning a fault as data: when the
+// response carries one, whatever its HTTP status, it is decoded into fault
+// and the response body is returned with a nil error. Errors returned by a
+// fault mapper are only recognized as faults when they wrap the *Fault.
+func (s *Client) CallFault(soapAction string, request interface{}, fault *Fault) (response []byte, err error) {
+	res, err := s.call(context.Background(), soapAction, request)
+	if err != nil {
+		var (
+			detected *Fault
+			httpErr  *HTTPError
+		)
+		if errors.As(err, &detected) {
+			*fault = *detected
+			if errors.As(err, &httpErr) {
+				response = httpErr.Body
+			}
+			err = nil
+		}
+		return
+	}
+	if detected := res.Fault(); detected != nil {
+		*fault = *detected
+	}
+	response = res.Body
+	return
+}
+
+// CallContext SOAP client API call abandoned when ctx is done
+func (s *Client) CallContext(ctx context.Context, soapAction string, request interface{}) ([]byte, error) {
+	res, err := s.call(ctx, soapAction, request)
+	if err != nil {
+		return nil, err
+	}
+	return res.Body, nil
+}
+
+// call send request wrapped in the client's envelope
+func (s *Client) call(ctx context.Context, soapAction string, request interface{}) (*Response, error) {
+	envelope := s.envelope(soapAction, request)
+	return s.Do(ctx, soapAction, &envelope)
+}
+
+// Do SOAP client API primitive the other calls build on: send envelope as
+// given, without the client's SOAP header or operation namespace but with
+// its token, HTTP headers, retries and every other option applied, and
+// return the whole response. An unsuccessful HTTP status is returned as an
+// *HTTPError, wrapping the fault if any; a fault sent with a successful
+// status is left for Response.Fault and Response.Decode to report.
+func (s *Client) Do(ctx context.Context, soapAction string, envelope *Envelope) (res *Response, err error) {
+	err = s.withToken(ctx, *envelope, func(envelope Envelope) (err error) {
+		res, err = s.roundTrip(ctx, soapAction, envelope, nil)
+		return
+	})
+	return
+}
+
+// envelope wrap request in an Envelope carrying the client's SOAP header
+func (s *Client) envelope(soapAction string, request interface{}) Envelope {
+	return s.buildEnvelope(soapAction, request, true)
+}
+
+// buildEnvelope wrap request in an Envelope; unless send is set, state such
+// as message numbering is left untouched
+func (s *Client) buildEnvelope(soapAction string, request interface{}, send bool) Envelope {
+	if ns, ok := s.namespaces[NormalizeSOAPAction(soapAction)]; ok {
+		if _, element := request.(Element); !element {
+			request = InNamespace(ns, request)
+		}
+	}
+	envelope := Envelope{
+		Body: Body{
+			Content: request,
+		},
+		BodyFirst: s.bodyFirst,
+	}
+	var (
+		blocks []interface{}
+		raw    RawXML
+	)
+	if r, ok := s.header.(RawXML); ok {
+		raw = r
+	} else if s.header != nil {
+		blocks = append(blocks, s.header)
+	}
+	if s.reliable != nil {
+		if send {
+			blocks = append(blocks, s.reliable.Next()...)
+		} else {
+			blocks = append(blocks, s.reliable.peek()...)
+		}
+	}
+	switch len(blocks) {
+	case 0:
+		if raw != nil {
+			envelope.Header = &Header{}
+		}
+	case 1:
+		envelope.Header = &Header{
+			Content: blocks[0],
+		}
+	default:
+		envelope.Header = &Header{
+			Content: blocks,
+		}
+	}
+	if envelope.Header != nil {
+		envelope.Header.Raw = raw
+	}
+	return envelope
+}
+
+// CallRaw POST request as the SOAP envelope with additional HTTP headers.
+// A []byte request is sent verbatim, e.g. to replay a payload captured
+// from logs; any other value is XML encoded.
+func (s *Client) CallRaw(soapAction string, request interface{}, httpHeaders map[string]string) (response []byte, err error) {
+	res, err := s.roundTrip(context.Background(), soapAction, request, httpHeaders)
+	if err != nil {
+		return
+	}
+	response = res.Body
+	return
+}
+
+// Response SOAP response along with details of the exchange
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// TLS negotiated connection state, nil when not using TLS
+	TLS *tls.ConnectionState
+	// Attachments parts of a multipart response besides the root SOAP
+	// part held in Body
+	Attachments []Attachment
+	// Trailer HTTP trailers sent after the body
+	Trailer http.Header
+	// Sent when the answered request was sent, Received when the response
+	// header arrived and Date the time of the server's Date header, zero
+	// when absent or malformed
+	Sent, Received, Date time.Time
+	// Attempts number of attempts the response took, RetryErrors why each
+	// of the Attempts-1 retried attempts failed, an *HTTPError without Body
+	// when it failed by its status
+	Attempts    int
+	RetryErrors []error
+
+	// faultDetection mode of the client that received the response
+	faultDetection FaultDetection
+}
+
+// Fault return the fault carried by the body, nil when none
+func (r *Response) Fault() *Fault {
+	return parseFault(r.Body, r.faultDetection)
+}
+
+// Decode decode the body into respHeader and respBody as DecodeResponse
+// does, detecting faults as the client that received it
+func (r *Response) Decode(respHeader, respBody interface{}) error {
+	return decodeResponse(bytes.NewReader(r.Body), respHeader, respBody, r.faultDetection)
+}
+
+// ServerOffset estimate how far the server clock is ahead of the local
+// one, negative when behind: Date compared with the middle of Sent and
+// Received. The Date header has a resolution of one second, so offsets
+// below it are noise. Zero without a Date header.
+func (r *Response) ServerOffset() time.Duration {
+	if r.Date.IsZero() {
+		return 0
+	}
+	middle := r.Sent.Add(r.Received.Sub(r.Sent) / 2)
+	return r.Date.Sub(middle)
+}
+
+// CallFull SOAP client API call returning the response with details of
+// the exchange, such as the negotiated TLS version and cipher suite
+func (s *Client) CallFull(soapAction string, request interface{}) (*Response, error) {
+	return s.call(context.Background(), soapAction, request)
+}
+
+// roundTrip send request and read the whole response
+func (s *Client) roundTrip(ctx context.Context, soapAction string, request interface{}, httpHeaders map[string]string) (*Response, error) {
+	ctx, cancel := s.withTimeout(ctx, soapAction)
+	defer cancel()
+	ctx, stall := s.withReadWatchdog(ctx)
+	defer stall()
+	res, ex, err := s.send(ctx, soapAction, request, httpHeaders)
+	if err != nil {
+		return nil, err
+	}
+	s.watchBody(res, stall)
+	defer res.Body.Close()
+
+	body, hint, err := s.checkResponse(res)
+	if err != nil {
+		return nil, err
+	}
+	if s.skipBody {
+		// small remainders are drained so the connection can be reused
+		io.CopyN(io.Discard, res.Body, maxDrain)
+		return newResponse(res, ex), nil
+	}
+	response, err := readBody(body, hint, s.zeroBuffers)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SOAP body: %w", err)
+	}
+	if s.onResponseBody != nil {
+		s.onResponseBody(res.StatusCode, response)
+	}
+	var attachments []Attachment
+	if contentType := res.Header.Get("Content-Type"); isMultipart(contentType) {
+		if response, attachments, err = splitMultipart(contentType, response, s.zeroBuffers); err != nil {
+			return nil, err
+		}
+	}
+	if err = checkDTD(response); err != nil {
+		return nil, err
+	}
+	if s.encryption != nil && s.encryption.Key != nil {
+		if response, err = DecryptBody(response, s.encryption.Key); err != nil {
+			return nil, err
+		}
+	}
+	if response, err = s.handleInvalidUTF8(response); err != nil {
+		return nil, err
+	}
+	if s.requireUTF8 {
+		if err = checkUTF8(res.Header.Get("Content-Type"), response); err != nil {
+			return nil, err
+		}
+	}
+	s.inspect(response)
+	r := newResponse(res, ex)
+	r.Body = response
+	r.faultDetection = s.faultDetection
+	r.Attachments = attachments
+	r.Trailer = res.Trailer
+	return r, nil
+}
+
+// exchange details of how the response returned by send was obtained
+type exchange struct {
+	// sent when the answered attempt was sent, received when its response
+	// header arrived
+	sent, received time.Time
+	// attempts number of attempts sent, failures errors of the retried ones
+	attempts int
+	failures []error
+}
+
+// newResponse return the Response to res, obtained through ex, without
+// its body
+func newResponse(res *http.Response, ex exchange) *Response {
+	response := &Response{
+		StatusCode:  res.StatusCode,
+		Header:      res.Header,
+		TLS:         res.TLS,
+		Sent:        ex.sent,
+		Received:    ex.received,
+		Attempts:    ex.attempts,
+		RetryErrors: ex.failures,
+	}
+	if date, err := http.ParseTime(res.Header.Get("Date")); err == nil {
+		response.Date = date
+	}
+	return response
+}
+
+// send POST request and return the response with its body unread
+func (s *Client) send(ctx context.Context, soapAction string, request interface{}, httpHeaders map[string]string) (res *http.Response, ex exchange, err error) {
+	req, err := s.newRequest(soapAction, request, httpHeaders)
+	if err != nil {
+		return
+	}
+	req = req.WithContext(ctx)
+	client := s.httpClient()
+	endpoint := req.URL.String()
+	for attempt := 1; ; attempt++ {
+		if s.breaker != nil {
+			if err = s.breaker.allow(endpoint); err != nil {
+				return
+			}
+		}
+		s.logRequest(req, attempt)
+		start := time.Now()
+		ex.sent = start
+		ex.attempts = attempt
+		res, err = client.Do(req)
+		ex.received = time.Now()
+		failed := err != nil || isBackendDown(res.StatusCode)
+		retry := failed
+		if err == nil && !s.isSuccess(res.StatusCode) &&
+			((failed || s.retryNonFault) && attempt < s.retryAttempts || failed && s.breaker != nil) {
+			// a fault is an answer, whatever the status: neither retried
+			// nor counted against the breaker
+			if retry, err = s.bufferNonFault(res); err == nil {
+				failed = retry
+			}
+		}
+		if s.breaker != nil {
+			// a call ended by its context says nothing of the endpoint
+			if ctx.Err() != nil {
+				s.breaker.abandon(endpoint)
+			} else {
+				s.breaker.record(endpoint, failed)
+			}
+		}
+		if err != nil && res != nil {
+			res.Body.Close()
+			return nil, ex, err
+		}
+		retry = retry && attempt < s.retryAttempts
+		s.logResponse(req, attempt, start, res, err, retry)
+		if !retry {
+			break
+		}
+		if err != nil {
+			ex.failures = append(ex.failures, err)
+		} else {
+			ex.failures = append(ex.failures, &HTTPError{StatusCode: res.StatusCode, Header: res.Header, URL: endpoint})
+			res.Body.Close()
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return nil, ex, &TransportError{Kind: transportErrorKind(err), Err: err}
+		case <-time.After(s.retryBackoff):
+		}
+		// the previous attempt consumed the body
+		if req.Body, err = req.GetBody(); err != nil {
+			return
+		}
+	}
+	if err != nil {
+		err = &TransportError{Kind: transportErrorKind(err), Err: err}
+		return
+	}
+	return
+}
+
+// newRequest build the HTTP request POSTing request
+func (s *Client) newRequest(soapAction string, request interface{}, httpHeaders map[string]string) (req *http.Request, err error) {
+	var buffer *bytes.Buffer
+	attached, withAttachments := request.(attachedRequest)
+	if withAttachments {
+		request = attached.envelope
+	}
+	if envelope, ok := request.(Envelope); ok && s.onEnvelope != nil {
+		if envelope.Header != nil {
+			header := *envelope.Header
+			envelope.Header = &header
+		}
+		if err = s.onEnvelope(&envelope); err != nil {
+			return
+		}
+		request = envelope
+	}
+	encoded := request
+	if envelope, ok := request.(Envelope); ok && s.encryption != nil && s.encryption.Recipient != nil {
+		if encoded, err = EncryptBody(envelope, s.encryption.Recipient, s.encryption.Algorithm); err != nil {
+			return
+		}
+	}
+	raw, isRaw := request.([]byte)
+	if isRaw {
+		buffer = bytes.NewBuffer(raw)
+	} else if buffer, err = encodeEnvelope(encoded, s.procInsts); err != nil {
+		return
+	} else {
+		if s.emptyElements == EmptySelfClosing {
+			encodedBuffer := buffer
+			if buffer, err = selfCloseEmpty(buffer.Bytes()); err != nil {
+				return
+			}
+			s.release(encodedBuffer)
+		}
+		if s.crlf {
+			lfBuffer := buffer
+			buffer = toCRLF(buffer.Bytes())
+			s.release(lfBuffer)
+		}
+		buffer.WriteString(s.trailer)
+	}
+	var multipartType string
+	if withAttachments {
+		root := buffer
+		if buffer, multipartType, err = s.encodeMultipart(buffer.Bytes(), attached.attachments); err != nil {
+			return
+		}
+		if !isRaw {
+			s.release(root)
+		}
+	}
+	compressed := s.compressRequests && buffer.Len() > s.compressThreshold
+	if compressed {
+		plain := buffer
+		if buffer, err = gzipBody(buffer.Bytes()); err != nil {
+			return
+		}
+		if !isRaw {
+			s.release(plain)
+		}
+	}
+	endpoint := s.url
+	if s.resolveURL != nil {
+		content := request
+		if envelope, ok := request.(Envelope); ok {
+			content = envelope.Body.Content
+		}
+		if endpoint, err = s.resolveURL(soapAction, content); err != nil {
+			err = fmt.Errorf("failed to resolve SOAP endpoint: %w", err)
+			return
+		}
+	}
+	req, err = http.NewRequest("POST", endpoint, buffer)
+	if err != nil {
+		err = fmt.Errorf("failed to create POST request: %s", err.Error())
+		return
+	}
+	data := buffer.Bytes()
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	contentType := "text/xml; charset=\"utf-8\""
+	if multipartType != "" {
+		contentType = multipartType
+	}
+	if s.contentTypeAction {
+		action := soapAction
+		if len(action) >= 2 && action[0] == '"' && action[len(action)-1] == '"' {
+			action = action[1 : len(action)-1]
+		}
+		contentType += "; action=" + quoteParam(action)
+	}
+	req.Header.Add("Content-Type", contentType)
+	req.Header.Set("SOAPAction", soapAction)
+	req.Header.Set("Content-Length", strconv.Itoa(buffer.Len()))
+	req.Header.Set("User-Agent", s.userAgent)
+	if s.identityEncoding {
+		req.Header.Set("Accept-Encoding", "identity")
+	} else {
+		req.Header.Set("Accept-Encoding", "gzip")
+	}
+	if compressed {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if s.acceptCharset != "" {
+		req.Header.Set("Accept-Charset", s.acceptCharset)
+	}
+	if s.digest != nil {
+		req.Header.Set(s.digest.header, s.digest.value(data))
+	}
+	if s.connection != "" {
+		req.Header.Set("Connection", s.connection)
+	}
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+	for key, value := range httpHeaders {
+		req.Header.Set(key, value)
+	}
+	if s.requireAction && NormalizeSOAPAction(req.Header.Get("SOAPAction")) == "" {
+		return nil, ErrSOAPActionRequired
+	}
+	if s.matchAction {
+		if err = checkSOAPAction(req.Header.Get("SOAPAction"), request); err != nil {
+			return nil, err
+		}
+	}
+	if s.connection != "" {
+		req.Close = hasToken(req.Header.Get("Connection"), "close")
+	}
+	return
+}
+
+// hasToken report whether the comma separated header value lists token
+func hasToken(value, token string) bool {
+	for _, t := range strings.Split(value, ",") {
+		if strings.EqualFold(strings.TrimSpace(t), token) {
+			return true
+		}
+	}
+	return false
+}
+
+// WithHeaders send headers with every call, e.g. an API key or tenant id.
+// They are applied over the headers set by the client, so setting
+// Content-Type or SOAPAction here replaces the generated value, and under
+// the headers passed to CallRaw, which win for that call. Repeated use
+// merges the headers.
+func WithHeaders(headers map[string]string) Option {
+	return func(c *Client) {
+		if c.headers == nil {
+			c.headers = make(map[string]string, len(headers))
+		}
+		for key, value := range headers {
+			c.headers[key] = value
+		}
+	}
+}
+
+// WithContentTypeAction also carry the SOAPAction as an action parameter
+// of the Content-Type, as gateways of some hybrid SOAP 1.1 servers require
+func WithContentTypeAction() Option {
+	return func(c *Client) {
+		c.contentTypeAction = true
+	}
+}
+
+// WithBodyFirst send the Body before the Header of the envelope. This
+// violates the spec and is only meant for legacy servers refusing the
+// standard order.
+func WithBodyFirst() Option {
+	return func(c *Client) {
+		c.bodyFirst = true
+	}
+}
+
+// WithURLResolver POST each call to the endpoint returned by resolve for
+// its SOAPAction and request, the operation element rather than the whole
+// envelope, instead of the client's URL, e.g. to route some operations to
+// a canary backend. The resolved URL is the one a circuit breaker tracks
+// and an *HTTPError reports; an error returned by resolve fails the call
+// without sending it.
+func WithURLResolver(resolve func(soapAction string, request interface{}) (string, error)) Option {
+	return func(c *Client) {
+		c.resolveURL = resolve
+	}
+}
+
+// WithConnection send value, e.g. "keep-alive" or "close", as the
+// Connection header of every request, for intermediaries expecting it
+// explicitly. The connection is closed after the response when the header
+// finally sent, possibly replaced through WithHeaders or CallRaw, lists
+// close, and kept open for reuse otherwise.
+func WithConnection(value string) Option {
+	return func(c *Client) {
+		c.connection = value
+	}
+}
+
+// WithRequestCompression gzip request bodies larger than threshold bytes,
+// sending them with Content-Encoding: gzip. Smaller bodies, for which
+// compression costs more CPU than it saves bytes, are sent as is. A body
+// digest is computed over the compressed bytes actually sent.
+func WithRequestCompression(threshold int) Option {
+	return func(c *Client) {
+		c.compressRequests = true
+		c.compressThreshold = threshold
+	}
+}
+
+// WithIdentityEncoding request uncompressed responses, sending
+// Accept-Encoding: identity instead of gzip and disabling the transport's
+// own compression, for servers sending corrupt gzip streams. Request
+// bodies are still compressed if WithRequestCompression is set.
+func WithIdentityEncoding() Option {
+	return func(c *Client) {
+		c.identityEncoding = true
+	}
+}
+
+// gzipBody return data gzip compressed
+func gzipBody(data []byte) (*bytes.Buffer, error) {
+	buffer := new(bytes.Buffer)
+	zw := gzip.NewWriter(buffer)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("failed to compress SOAP request: %s", err.Error())
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress SOAP request: %s", err.Error())
+	}
+	return buffer, nil
+}
+
+// WithTrailer end encoded envelopes with trailer, e.g. a single "\n" for
+// servers verifying a signature over the exact body. Envelopes are encoded
+// compact, without indentation, and are otherwise sent with no trailing
+// bytes. A []byte request passed to CallRaw is sent as is.
+func WithTrailer(trailer string) Option {
+	return func(c *Client) {
+		c.trailer = trailer
+	}
+}
+
+// WithZeroBuffers overwrite with zeros the buffers the client reads
+// responses into before returning them to its pool, and the intermediate
+// copies of requests, such as the uncompressed envelope, once done with,
+// so that sensitive data does not linger in reused or garbage memory. The
+// body of the request as sent, held by the HTTP transport, and the
+// responses returned, which belong to the caller, are left as is.
+func WithZeroBuffers() Option {
+	return func(c *Client) {
+		c.zeroBuffers = true
+	}
+}
+
+// release zero buffer, no longer used, when WithZeroBuffers is set
+func (s *Client) release(buffer *bytes.Buffer) {
+	if s.zeroBuffers {
+		b := buffer.Bytes()
+		clear(b[:cap(b)])
+	}
+}
+
+// WithProcessingInstruction write the processing instruction
+// <?target inst?> between the XML declaration and the envelope, e.g.
+// xml-stylesheet with inst `type="text/xsl" href="soap.xsl"` for a
+// stylesheet driven server. Instructions are written in the order set,
+// each on its own line.
+func WithProcessingInstruction(target, inst string) Option {
+	return func(c *Client) {
+		c.procInsts = append(c.procInsts, xml.ProcInst{Target: target, Inst: []byte(inst)})
+	}
+}
+
+// WithCRLF end the lines of encoded envelopes with CRLF rather than LF,
+// for platforms rejecting bare LF. Newlines within encoded text and
+// attribute values are character references and are left alone, but
+// every bare LF written as is, including those inside pre-serialized
+// content such as RawXML headers and ",innerxml" fields, becomes CRLF:
+// XML processors read it back as LF, while a digest computed over the raw
+// bytes of such content no longer matches. The trailer is sent as set.
+func WithCRLF() Option {
+	return func(c *Client) {
+		c.crlf = true
+	}
+}
+
+// toCRLF return data with every bare LF replaced by CRLF
+func toCRLF(data []byte) *bytes.Buffer {
+	buffer := bytes.NewBuffer(make([]byte, 0, len(data)+bytes.Count(data, []byte{'\n'})))
+	for i, b := range data {
+		if b == '\n' && (i == 0 || data[i-1] != '\r') {
+			buffer.WriteByte('\r')
+		}
+		buffer.WriteByte(b)
+	}
+	return buffer
+}
+
+// DigestAlgorithm hash algorithm of a body digest header
+type DigestAlgorithm string
+
+// DigestAlgorithm values, named as in the Digest header
+const (
+	DigestMD5    DigestAlgorithm = "MD5"
+	DigestSHA256 DigestAlgorithm = "SHA-256"
+)
+
+type bodyDigest struct {
+	header    string
+	algorithm DigestAlgorithm
+}
+
+// value return the header value for body: the base64 digest, prefixed by
+// the algorithm name in a Digest header
+func (b *bodyDigest) value(body []byte) string {
+	var sum []byte
+	switch b.algorithm {
+	case DigestMD5:
+		h := md5.Sum(body)
+		sum = h[:]
+	default:
+		h := sha256.Sum256(body)
+		sum = h[:]
+	}
+	value := base64.StdEncoding.EncodeToString(sum)
+	if http.CanonicalHeaderKey(b.header) == "Digest" {
+		value = string(b.algorithm) + "=" + value
+	}
+	return value
+}
+
+// WithBodyDigest send a digest of the request body, computed over the bytes
+// transmitted, in header, e.g. "Content-MD5" with DigestMD5 or "Digest"
+// (as "SHA-256=...") with DigestSHA256, for gateways checking integrity
+func WithBodyDigest(header string, algorithm DigestAlgorithm) Option {
+	return func(c *Client) {
+		c.digest = &bodyDigest{header: header, algorithm: algorithm}
+	}
+}
+
+// ErrSOAPActionRequired returned without sending when RequireSOAPAction is
+// set and the call has no SOAPAction
+var ErrSOAPActionRequired = errors.New("SOAPAction is required but empty")
+
+// RequireSOAPAction fail calls with an empty SOAPAction locally with
+// ErrSOAPActionRequired, for services rejecting them with an unhelpful
+// error. An action set through WithHeaders or CallRaw headers counts.
+func RequireSOAPAction() Option {
+	return func(c *Client) {
+		c.requireAction = true
+	}
+}
+
+// SOAPActioner request declaring the SOAPAction of its operation
+type SOAPActioner interface {
+	SOAPAction() string
+}
+
+// ErrSOAPActionMismatch returned without sending when
+// RequireMatchingSOAPAction is set and a call's SOAPAction is not the one
+// its request declares
+var ErrSOAPActionMismatch = errors.New("SOAPAction does not match the request")
+
+// RequireMatchingSOAPAction fail calls whose request implements
+// SOAPActioner locally with ErrSOAPActionMismatch when the SOAPAction sent,
+// set through WithHeaders or CallRaw headers included, does not match the
+// declared one as MatchSOAPAction does, to catch a request paired with the
+// wrong action. Other requests are sent unchecked.
+func RequireMatchingSOAPAction() Option {
+	return func(c *Client) {
+		c.matchAction = true
+	}
+}
+
+// checkSOAPAction return ErrSOAPActionMismatch when the content of request
+// declares another SOAPAction than soapAction
+func checkSOAPAction(soapAction string, request interface{}) error {
+	if envelope, ok := request.(Envelope); ok {
+		request = envelope.Body.Content
+	}
+	if element, ok := request.(Element); ok {
+		request = element.Content
+	}
+	actioner, ok := request.(SOAPActioner)
+	if !ok || MatchSOAPAction(soapAction, actioner.SOAPAction(), false) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s sent for %s", ErrSOAPActionMismatch, soapAction, actioner.SOAPAction())
+}
+
+// SOAPAction return the quoted SOAPAction of operation following the
+// convention of most WSDLs, namespace and operation joined by a single
+// slash, e.g. "http://example.com/orders/GetOrder" for namespace
+// "http://example.com/orders/" and operation "GetOrder". Services using
+// another format take their action string as is: Call sends it verbatim.
+func SOAPAction(namespace, operation string) string {
+	action := operation
+	if namespace != "" {
+		action = strings.TrimRight(namespace, "/") + "/" + strings.TrimLeft(operation, "/")
+	}
+	return `"` + action + `"`
+}
+
+// NormalizeSOAPAction return action without the whitespace and quotes
+// surrounding it, e.g. urn:orders/GetOrder for ` "urn:orders/GetOrder" `
+func NormalizeSOAPAction(action string) string {
+	return strings.Trim(action, "\" \t")
+}
+
+// MatchSOAPAction report whether the SOAPAction received from a client
+// designates expected once both are normalized, ignoring letter case when
+// foldCase is set, so server-side routing does not reject clients quoting
+// or spelling the action slightly differently
+func MatchSOAPAction(received, expected string, foldCase bool) bool {
+	received, expected = NormalizeSOAPAction(received), NormalizeSOAPAction(expected)
+	if foldCase {
+		return strings.EqualFold(received, expected)
+	}
+	return received == expected
+}
+
+// quoteParam return v as a quoted MIME parameter value
+func quoteParam(v string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
+
+// DryRun return the HTTP request Call would send for soapAction and
+// request, headers and serialized envelope included, without sending it.
+// Generated header blocks are those of the next call; in particular the
+// next message number of a reliable sequence is shown but not consumed.
+func (s *Client) DryRun(soapAction string, request interface{}) (*http.Request, error) {
+	envelope := s.buildEnvelope(soapAction, request, false)
+	if s.tokens != nil {
+		header, _, err := s.tokens.get(context.Background())
+		if err != nil {
+			return nil, err
+		}
+		envelope = addHeaderBlock(envelope, header)
+	}
+	return s.newRequest(soapAction, envelope, nil)
+}
+
+// WithSuccessStatus treat responses with one of codes as successful, for
+// servers answering some operations with non-standard codes such as 250.
+// codes replace the default set, 200 alone, so it must be listed to be
+// kept. Any other status fails the call with an *HTTPError.
+func WithSuccessStatus(codes ...int) Option {
+	return func(c *Client) {
+		c.successStatus = make(map[int]bool, len(codes))
+		for _, code := range codes {
+			c.successStatus[code] = true
+		}
+	}
+}
+
+// isSuccess report whether status is a successful response status
+func (s *Client) isSuccess(status int) bool {
+	if s.successStatus == nil {
+		return status == http.StatusOK
+	}
+	return s.successStatus[status]
+}
+
+// checkResponse return the decompressed body of a successful res along
+// with its expected size, negative when unknown. Any other status is
+// returned as an *HTTPError.
+func (s *Client) checkResponse(res *http.Response) (body io.Reader, hint int64, err error) {
+	if body, hint, err = s.openBody(res); err != nil {
+		return
+	}
+	if !s.isSuccess(res.StatusCode) {
+		err = s.statusError(res, body, hint)
+	}
+	return
+}
+
+// openBody return the decompressed body of res, bounded by the maximum
+// response size, along with its expected size, negative when unknown
+func (s *Client) openBody(res *http.Response) (body io.Reader, hint int64, err error) {
+	body, err = s.responseBody(res)
+	if err != nil {
+		err = fmt.Errorf("failed to decompress SOAP response: %s", err.Error())
+		return
+	}
+	hint = res.ContentLength
+	if body != io.Reader(res.Body) {
+		hint = -1
+	}
+	if s.maxResponseSize > 0 {
+		// enforced on the bytes read, as chunked and compressed bodies
+		// have no Content-Length to check upfront
+		body = &limitedReader{r: body, n: s.maxResponseSize}
+		if hint > s.maxResponseSize {
+			hint = s.maxResponseSize
+		}
+	}
+	if !s.keepBOM {
+		body = skipBOM(body)
+	}
+	return
+}
+
+// utf8BOM byte order mark some servers prefix UTF-8 bodies with
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// skipBOM return r past a leading UTF-8 byte order mark
+func skipBOM(r io.Reader) io.Reader {
+	// reads at least as large as the buffer bypass it
+	br := bufio.NewReaderSize(r, 16)
+	if prefix, _ := br.Peek(len(utf8BOM)); bytes.Equal(prefix, utf8BOM) {
+		br.Discard(len(utf8BOM))
+	}
+	return br
+}
+
+// KeepBOM leave a UTF-8 byte order mark prefixing a response body in
+// place. By default it is stripped before the body is inspected, decoded
+// or returned, as a BOM, while allowed, trips up many XML consumers.
+func KeepBOM() Option {
+	return func(c *Client) {
+		c.keepBOM = true
+	}
+}
+
+// statusError read the body of the unsuccessful res into an *HTTPError
+func (s *Client) statusError(res *http.Response, body io.Reader, hint int64) error {
+	soapFault, err := readBody(body, hint, s.zeroBuffers)
+	if err != nil {
+		return fmt.Errorf("failed to read SOAP fault response body: %w", err)
+	}
+	if s.onResponseBody != nil {
+		s.onResponseBody(res.StatusCode, soapFault)
+	}
+	if s.invalidUTF8 == InvalidUTF8Replace {
+		soapFault, _ = s.handleInvalidUTF8(soapFault)
+	}
+	s.inspect(soapFault)
+	fault := parseFault(soapFault, s.faultDetection)
+	s.inspectFault(fault)
+	err = &HTTPError{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		Body:       soapFault,
+		Fault:      fault,
+		URL:        res.Request.URL.String(),
+	}
+	if fault != nil {
+		err = s.mapFault(fault, err)
+	}
+	return err
+}
+
+// EmptyElementForm serialization of elements without content
+type EmptyElementForm int
+
+// EmptyElementForm values
+const (
+	// EmptyExplicit open and close tags, <foo></foo>, as encoding/xml does
+	EmptyExplicit EmptyElementForm = iota
+	// EmptySelfClosing self-closing tag, <foo/>
+	EmptySelfClosing
+)
+
+// WithEmptyElements serialize empty elements of encoded envelopes in form.
+// encoding/xml only emits the explicit form, so the self-closing one is
+// obtained by scanning the encoded envelope again and rewriting it, which
+// roughly doubles the encoding cost; leave it off unless a server requires
+// it. []byte requests passed to CallRaw are sent as is.
+func WithEmptyElements(form EmptyElementForm) Option {
+	return func(c *Client) {
+		c.emptyElements = form
+	}
+}
+
+// InvalidUTF8Handling treatment of invalid bytes in a response that
+// declares UTF-8, or no encoding at all
+type InvalidUTF8Handling int
+
+// InvalidUTF8Handling values
+const (
+	// InvalidUTF8Pass return the body as is, leaving decoding to fail
+	InvalidUTF8Pass InvalidUTF8Handling = iota
+	// InvalidUTF8Replace replace each invalid sequence with U+FFFD
+	InvalidUTF8Replace
+	// InvalidUTF8Reject fail the call with an *InvalidUTF8Error
+	InvalidUTF8Reject
+)
+
+// WithInvalidUTF8 handle invalid bytes in responses declaring UTF-8, or no
+// encoding, as handling sets, e.g. replacing them so that a single bad byte
+// in a text node does not fail an otherwise usable response. Fault bodies
+// of unsuccessful statuses are only ever repaired, never rejected.
+func WithInvalidUTF8(handling InvalidUTF8Handling) Option {
+	return func(c *Client) {
+		c.invalidUTF8 = handling
+	}
+}
+
+// InvalidUTF8Error invalid UTF-8 in a response rejected by InvalidUTF8Reject
+type InvalidUTF8Error struct {
+	// Offset of the first invalid byte in the body
+	Offset int
+	// Snippet body around Offset, invalid bytes quoted
+	Snippet string
+}
+
+func (e *InvalidUTF8Error) Error() string {
+	return fmt.Sprintf("invalid UTF-8 in SOAP response at offset %d: %q", e.Offset, e.Snippet)
+}
+
+// invalidUTF8Context bytes of body kept on each side of an invalid byte
+const invalidUTF8Context = 32
+
+// handleInvalidUTF8 return body handled according to s.invalidUTF8
+func (s *Client) handleInvalidUTF8(body []byte) ([]byte, error) {
+	if s.invalidUTF8 == InvalidUTF8Pass || utf8.Valid(body) {
+		return body, nil
+	}
+	if encoding := declaredEncoding(body); encoding != "" && !isUTF8Label(encoding) {
+		return body, nil
+	}
+	if s.invalidUTF8 == InvalidUTF8Replace {
+		return bytes.ToValidUTF8(body, []byte("\uFFFD")), nil
+	}
+	offset := 0
+	for offset < len(body) {
+		r, size := utf8.DecodeRune(body[offset:])
+		if r == utf8.RuneError && size <= 1 {
+			break
+		}
+		offset += size
+	}
+	start, end := offset-invalidUTF8Context, offset+invalidUTF8Context
+	if start < 0 {
+		start = 0
+	}
+	if end > len(body) {
+		end = len(body)
+	}
+	return nil, &InvalidUTF8Error{Offset: offset, Snippet: string(body[start:end])}
+}
+
+// selfCloseEmpty rewrite the elements of data opened and closed with
+// nothing in between into self-closing tags
+func selfCloseEmpty(data []byte) (*bytes.Buffer, error) {
+	var (
+		out        = bytes.NewBuffer(make([]byte, 0, len(data)))
+		last       int64
+		openEnd    int64
+		justOpened bool
+	)
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to rewrite empty elements: %s", err.Error())
+		}
+		switch token.(type) {
+		case xml.StartElement:
+			openEnd, justOpened = d.InputOffset(), true
+			continue
+		case xml.EndElement:
+			if justOpened && data[openEnd-1] == '>' {
+				out.Write(data[last : openEnd-1])
+				out.WriteString("/>")
+				last = d.InputOffset()
+			}
+		}
+		justOpened = false
+	}
+	out.Write(data[last:])
+	return out, nil
+}
+
+// encodeEnvelope serialize envelope with an XML declaration
+func encodeEnvelope(envelope interface{}, procInsts []xml.ProcInst) (*bytes.Buffer, error) {
+	buffer := new(bytes.Buffer)
+	buffer.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	encoder := xml.NewEncoder(buffer)
+	for _, pi := range procInsts {
+		if strings.EqualFold(pi.Target, "xml") {
+			return nil, errors.New("failed to encode envelope: processing instruction target xml is reserved")
+		}
+		if err := encoder.EncodeToken(pi); err != nil {
+			return nil, fmt.Errorf("failed to encode envelope: %s", err.Error())
+		}
+		if err := encoder.EncodeToken(xml.CharData("\n")); err != nil {
+			return nil, fmt.Errorf("failed to encode envelope: %s", err.Error())
+		}
+	}
+	// encoder.Indent("  ", "    ")
+	if err := encoder.Encode(envelope); err != nil {
+		return nil, fmt.Errorf("failed to encode envelope: %s", err.Error())
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, fmt.Errorf("failed to flush encoder: %s", err.Error())
+	}
+	return buffer, nil
+}
+
+// responseBody return res body undoing its Content-Encoding. A body
+// advertised as gzip but lacking the gzip magic bytes is passed through
+// as is, since some intermediaries mislabel plain responses. With
+// WithGzipSniffing a body lacking Content-Encoding is decompressed when
+// it starts with the gzip magic bytes.
+func (s *Client) responseBody(res *http.Response) (io.Reader, error) {
+	advertised := strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip")
+	sniff := s.sniffGzip && res.Header.Get("Content-Encoding") == ""
+	if !advertised && !sniff {
+		return res.Body, nil
+	}
+	br := bufio.NewReader(res.Body)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(magic) == 0 {
+		return br, nil
+	}
+	if !bytes.Equal(magic, gzipMagic) {
+		if advertised {
+			s.warn(WarningGzipNotCompressed, "Content-Encoding is gzip but body is not gzip compressed")
+		}
+		return br, nil
+	}
+	if !advertised {
+		s.warn(WarningGzipUnadvertised, "body is gzip compressed but has no Content-Encoding")
+	}
+	return gzip.NewReader(br)
+}
+
+// WithGzipSniffing decompress response bodies starting with the gzip magic
+// bytes even without a Content-Encoding header, for servers compressing
+// without advertising it. No XML document starts with these bytes, but
+// other payloads may, hence the opt-in. Bodies with another
+// Content-Encoding are left alone.
+func WithGzipSniffing() Option {
+	return func(c *Client) {
+		c.sniffGzip = true
+	}
+}
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+const (
+	// maxSizeHint cap on preallocation from an untrusted Content-Length
+	maxSizeHint = 16 << 20
+	// maxPooledBuffer largest buffer kept for reuse, so that one huge
+	// response does not pin its memory in the pool
+	maxPooledBuffer = 1 << 20
+	// maxDrain most bytes of an unwanted body read to reuse the connection
+	maxDrain = 64 << 10
+)
+
+// ErrResponseTooLarge returned when a response body exceeds the size set
+// by WithMaxResponseSize
+var ErrResponseTooLarge = errors.New("SOAP response exceeds the maximum size")
+
+// WithMaxResponseSize fail calls whose response body, once decompressed,
+// exceeds n bytes with ErrResponseTooLarge, whether the body is sized by a
+// Content-Length or sent chunked
+func WithMaxResponseSize(n int64) Option {
+	return func(c *Client) {
+		c.maxResponseSize = n
+	}
+}
+
+// SkipResponseBody return the status and headers of successful responses
+// without reading their body, for probes against verbose endpoints: Call
+// returns a nil body. Failed responses are still read for their fault.
+func SkipResponseBody() Option {
+	return func(c *Client) {
+		c.skipBody = true
+	}
+}
+
+// limitedReader read r, failing with ErrResponseTooLarge past n bytes
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if l.n -= int64(n); l.n < 0 {
+		return 0, ErrResponseTooLarge
+	}
+	return n, err
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// readBody read r to EOF through a pooled buffer presized from sizeHint,
+// a negative hint meaning unknown, and return an exactly sized copy
+func readBody(r io.Reader, sizeHint int64, zero bool) ([]byte, error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		if zero {
+			b := buf.Bytes()
+			clear(b[:cap(b)])
+		}
+		if buf.Cap() <= maxPooledBuffer {
+			buf.Reset()
+			bufferPool.Put(buf)
+		}
+	}()
+	buf.Reset()
+	if sizeHint > maxSizeHint {
+		sizeHint = maxSizeHint
+	}
+	if sizeHint > 0 {
+		// spare room lets ReadFrom hit EOF without growing
+		buf.Grow(int(sizeHint) + bytes.MinRead)
+	}
+	_, err := buf.ReadFrom(r)
+	b := make([]byte, buf.Len())
+	copy(b, buf.Bytes())
+	return b, err
 }
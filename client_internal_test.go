@@ -0,0 +1,194 @@
+package soap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// mixedBodies mostly tiny responses with the occasional large one
+var mixedBodies = func() [][]byte {
+	var bodies [][]byte
+	for _, size := range []int{128, 256, 128, 512, 1 << 20, 128, 256, 64 << 10} {
+		bodies = append(bodies, bytes.Repeat([]byte("x"), size))
+	}
+	return bodies
+}()
+
+func BenchmarkReadBody(b *testing.B) {
+	b.Run("ReadAll", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			body := mixedBodies[i%len(mixedBodies)]
+			if _, err := ioutil.ReadAll(bytes.NewReader(body)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Pooled", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			body := mixedBodies[i%len(mixedBodies)]
+			if _, err := readBody(bytes.NewReader(body), int64(len(body)), false); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkRequestCompression(b *testing.B) {
+	type message struct {
+		XMLName xml.Name `xml:"urn:example echo"`
+		Text    string   `xml:"text"`
+	}
+	small := message{Text: "ping"}
+	for name, client := range map[string]*Client{
+		"Always":    NewClient("http://localhost/", false, nil, WithRequestCompression(0)),
+		"Threshold": NewClient("http://localhost/", false, nil, WithRequestCompression(1024)),
+	} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := client.newRequest("", small, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestReadBody(t *testing.T) {
+	for _, body := range mixedBodies {
+		for _, hint := range []int64{-1, 0, int64(len(body)), int64(len(body)) / 2, maxSizeHint * 2} {
+			for _, zero := range []bool{false, true} {
+				b, err := readBody(bytes.NewReader(body), hint, zero)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(b, body) {
+					t.Fatalf("hint %d: read %d bytes, want %d", hint, len(b), len(body))
+				}
+			}
+		}
+	}
+}
+
+func TestZeroBuffers(t *testing.T) {
+	client := NewClient("http://localhost/", false, nil, WithZeroBuffers(), WithRequestCompression(0), WithCRLF())
+	buffer := bytes.NewBufferString("<password>secret</password>")
+	buffer.Truncate(10)
+	client.release(buffer)
+	b := buffer.Bytes()
+	if !bytes.Equal(b[:cap(b)], make([]byte, cap(b))) {
+		t.Errorf("want buffer zeroed up to its capacity, got %q", b[:cap(b)])
+	}
+	raw := []byte("<Envelope>secret</Envelope>")
+	if _, err := client.DryRun("", raw); err != nil {
+		t.Fatal(err)
+	}
+	if string(raw) != "<Envelope>secret</Envelope>" {
+		t.Errorf("want raw request left intact, got %q", raw)
+	}
+}
+
+func TestSelfCloseEmpty(t *testing.T) {
+	cases := map[string]string{
+		`<a><b></b><c x="1"></c><d> </d><e>text</e></a>`:         `<a><b/><c x="1"/><d> </d><e>text</e></a>`,
+		`<?xml version="1.0"?>` + "\n" + `<a xmlns="urn:x"></a>`: `<?xml version="1.0"?>` + "\n" + `<a xmlns="urn:x"/>`,
+		`<a><b><c></c></b></a>`:                                  `<a><b><c/></b></a>`,
+		`<a><!--x--></a>`:                                        `<a><!--x--></a>`,
+	}
+	for in, want := range cases {
+		got, err := selfCloseEmpty([]byte(in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.String() != want {
+			t.Errorf("want %s, got %s", want, got)
+		}
+	}
+}
+
+// oneByteResponse return a response whose body, optionally gzip
+// compressed, is read one byte at a time
+func oneByteResponse(body string, compress bool) *http.Response {
+	data := []byte(body)
+	header := http.Header{}
+	if compress {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(data)
+		zw.Close()
+		data = buf.Bytes()
+		header.Set("Content-Encoding", "gzip")
+	}
+	return &http.Response{
+		StatusCode:    http.StatusOK,
+		Header:        header,
+		Body:          ioutil.NopCloser(iotest.OneByteReader(bytes.NewReader(data))),
+		ContentLength: -1,
+	}
+}
+
+func TestStreamOneByteReads(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("\uFEFF<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<soap:Envelope xmlns:soap=\"http://schemas.xmlsoap.org/soap/envelope/\"><soap:Body>")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&b, `<l:record xmlns:l="urn:ledger"><seq>%d</seq><note><![CDATA[a & b]]> &amp; caf&#xE9;</note></l:record>`, i)
+	}
+	b.WriteString("</soap:Body></soap:Envelope>")
+	envelope := b.String()
+
+	type record struct {
+		Seq  int    `xml:"seq"`
+		Note string `xml:"note"`
+	}
+	for _, compress := range []bool{false, true} {
+		client := NewClient("http://localhost/", false, nil, WithMaxResponseSize(1<<20))
+		body, _, err := client.openBody(oneByteResponse(envelope, compress))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		err = streamBody(xml.NewDecoder(body), FaultDetectStrict, nil, func(d *xml.Decoder, start xml.StartElement) error {
+			var r record
+			if err := d.DecodeElement(&r, &start); err != nil {
+				return err
+			}
+			if r.Seq != n || r.Note != "a & b & café" {
+				return fmt.Errorf("record %d: unexpected %+v", n, r)
+			}
+			n++
+			return nil
+		})
+		if err != nil || n != 100 {
+			t.Errorf("gzip %v: want 100 records, got %d, %v", compress, n, err)
+		}
+	}
+
+	const fault = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>` +
+		`<faultcode>soap:Server</faultcode><faultstring>failed</faultstring><detail><trace>at Frame&#46;run</trace></detail></soap:Fault></soap:Body></soap:Envelope>`
+	var detail []byte
+	err := streamBody(xml.NewDecoder(iotest.OneByteReader(strings.NewReader(fault))), FaultDetectStrict,
+		func(f *Fault, r io.Reader) (err error) {
+			detail, err = ioutil.ReadAll(iotest.OneByteReader(r))
+			return err
+		}, nil)
+	if f, ok := err.(*Fault); !ok || f.String != "failed" || string(detail) != "at Frame.run" {
+		t.Errorf("want fault with streamed detail, got %v, %q", err, detail)
+	}
+
+	const single = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<record><seq>7</seq><note><![CDATA[a & b]]> &amp; caf&#xE9;</note></record></soap:Body></soap:Envelope>`
+	var r record
+	if err := DecodeResponse(iotest.OneByteReader(strings.NewReader(single)), nil, &r); err != nil || r.Seq != 7 || r.Note != "a & b & café" {
+		t.Errorf("want record decoded, got %+v, %v", r, err)
+	}
+}
@@ -1,10 +1,25 @@
 package soap_test
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"io/ioutil"
+	"mime"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/achiku/testsvr"
 	"github.com/achiku/xml"
@@ -128,10 +143,110 @@ func withSOAPHeaderResponse(logger testsvr.Logger) http.HandlerFunc {
 	}
 }
 
+const personEnvelope = `<?xml version="1.0" encoding="UTF-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <person><id>1</id><name><first>Moga</first><last>Mogami</last></name><age>22</age></person>
+  </soap:Body>
+</soap:Envelope>`
+
+func gzipResponse(logger testsvr.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(personEnvelope))
+		zw.Close()
+		w.Header().Set("Content-Type", "text/xml")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(buf.Bytes())
+	}
+}
+
+func chunkedResponse(logger testsvr.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		for _, chunk := range strings.SplitAfter(personEnvelope, "\n") {
+			w.Write([]byte(chunk))
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+func gzipPlainResponse(logger testsvr.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write([]byte(personEnvelope))
+	}
+}
+
+func gzipBareResponse(logger testsvr.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write([]byte(personEnvelope))
+		zw.Close()
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write(buf.Bytes())
+	}
+}
+
+func bomResponse(logger testsvr.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte("\uFEFF" + personEnvelope))
+	}
+}
+
+const faultEnvelope = `<?xml version="1.0" encoding="UTF-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <soap:Fault>
+      <faultcode>soap:Server</faultcode>
+      <faultstring>Something went wrong</faultstring>
+      <faultactor>Actor</faultactor>
+      <detail>details</detail>
+    </soap:Fault>
+  </soap:Body>
+</soap:Envelope>`
+
+func rawFaultResponse(logger testsvr.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Header().Set("X-Request-Id", "42")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(faultEnvelope))
+	}
+}
+
+func echoResponse(logger testsvr.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rawbody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		w.Header().Set("X-SOAPAction", r.Header.Get("SOAPAction"))
+		w.Write(rawbody)
+	}
+}
+
 var DefaultHandlerMap = map[string]testsvr.CreateHandler{
-	"/noheader": noSOAPHeaderResponse,
-	"/header":   withSOAPHeaderResponse,
-	"/error":    withSOAPFaultResponse,
+	"/noheader":  noSOAPHeaderResponse,
+	"/header":    withSOAPHeaderResponse,
+	"/error":     withSOAPFaultResponse,
+	"/gzip":      gzipResponse,
+	"/gzipplain": gzipPlainResponse,
+	"/gzipbare":  gzipBareResponse,
+	"/fault":     rawFaultResponse,
+	"/echo":      echoResponse,
+	"/chunked":   chunkedResponse,
+	"/bom":       bomResponse,
 }
 
 func TestClientNoSOAPHeader(t *testing.T) {
@@ -183,3 +298,1232 @@ func TestClientSOAPFault(t *testing.T) {
 	}
 	t.Log(err)
 }
+
+func TestClientGzipResponse(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	var warnings []Warning
+	url := ts.URL + "/gzip"
+	client := NewClient(url, false, nil, OnWarning(func(w Warning) {
+		warnings = append(warnings, w)
+	}))
+	resp, err := client.Call(url, testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != personEnvelope {
+		t.Errorf("want %s, got %s", personEnvelope, resp)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("want no warnings, got %+v", warnings)
+	}
+}
+
+func TestClientDo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/xml")
+		if strings.Contains(string(b), "<userId>") {
+			w.Write([]byte(personEnvelope))
+			return
+		}
+		w.Write([]byte(faultEnvelope))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, false, nil)
+	envelope := &Envelope{
+		Header: &Header{Content: &myRequestHeader{UserID: "user"}},
+		Body:   Body{Content: testRequest{Message: "test"}},
+	}
+	res, err := client.Do(context.Background(), "", envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p person
+	if res.StatusCode != http.StatusOK || res.Fault() != nil {
+		t.Errorf("want success without fault, got %d %v", res.StatusCode, res.Fault())
+	}
+	if err := res.Decode(nil, &p); err != nil || p.Name == nil || p.Name.First != "Moga" {
+		t.Errorf("want person decoded, got %+v, %v", p, err)
+	}
+
+	envelope.Header = nil
+	if res, err = client.Do(context.Background(), "", envelope); err != nil {
+		t.Fatal(err)
+	}
+	if fault := res.Fault(); fault == nil || fault.String != "Something went wrong" {
+		t.Errorf("want fault, got %v", fault)
+	}
+	var fault *Fault
+	if err := res.Decode(nil, &p); !errors.As(err, &fault) {
+		t.Errorf("want fault from Decode, got %v", err)
+	}
+}
+
+func TestClientOnEnvelope(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	header := &myRequestHeader{UserID: "user"}
+	var seq int
+	client := NewClient(ts.URL+"/echo", false, header, OnEnvelope(func(e *Envelope) error {
+		seq++
+		e.Header.Content = &myRequestHeader{UserID: header.UserID, Password: strconv.Itoa(seq)}
+		e.Body.Content = testRequest{Message: e.Body.Content.(testRequest).Message + "!"}
+		return nil
+	}))
+	for i := 1; i <= 2; i++ {
+		resp, err := client.Call("", testRequest{Message: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(resp), "<password>"+strconv.Itoa(i)+"</password>") || !strings.Contains(string(resp), "<message>test!</message>") {
+			t.Errorf("want modified envelope sent, got %s", resp)
+		}
+	}
+	if header.Password != "" {
+		t.Error("want the client header left untouched")
+	}
+
+	stop := errors.New("stop")
+	client = NewClient(ts.URL+"/echo", false, nil, OnEnvelope(func(*Envelope) error { return stop }))
+	if _, err := client.Call("", testRequest{Message: "test"}); !errors.Is(err, stop) {
+		t.Errorf("want hook error, got %v", err)
+	}
+}
+
+func TestClientOnResponseBody(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	var logged []string
+	client := NewClient(ts.URL+"/gzip", false, nil, OnResponseBody(func(status int, body []byte) {
+		logged = append(logged, fmt.Sprintf("%d %s", status, body))
+	}))
+	resp, err := client.Call("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p person
+	if err := DecodeResponse(bytes.NewReader(resp), nil, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name == nil || p.Name.First != "Moga" {
+		t.Errorf("unexpected person %+v", p)
+	}
+	if len(logged) != 1 || logged[0] != "200 "+personEnvelope {
+		t.Errorf("want the complete body logged once, got %q", logged)
+	}
+
+	logged = nil
+	client = NewClient(ts.URL+"/fault", false, nil, OnResponseBody(func(status int, body []byte) {
+		logged = append(logged, fmt.Sprintf("%d %s", status, body))
+	}))
+	_, err = client.Call("", testRequest{Message: "test"})
+	var fault *Fault
+	if !errors.As(err, &fault) || fault.String != "Something went wrong" {
+		t.Errorf("want fault parsed from the logged body, got %v", err)
+	}
+	if len(logged) != 1 || logged[0] != "500 "+faultEnvelope {
+		t.Errorf("want the fault body logged once, got %q", logged)
+	}
+
+	logged = nil
+	client = NewClient(ts.URL+"/gzip", false, nil, WithMaxResponseSize(16), OnResponseBody(func(status int, body []byte) {
+		logged = append(logged, string(body))
+	}))
+	if _, err := client.Call("", testRequest{Message: "test"}); err == nil || len(logged) != 0 {
+		t.Errorf("want oversized body rejected before logging, got %v and %q", err, logged)
+	}
+}
+
+func TestClientGzipAdvertisedPlainResponse(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	var warnings []Warning
+	url := ts.URL + "/gzipplain"
+	client := NewClient(url, false, nil, OnWarning(func(w Warning) {
+		warnings = append(warnings, w)
+	}))
+	resp, err := client.Call(url, testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != personEnvelope {
+		t.Errorf("want %s, got %s", personEnvelope, resp)
+	}
+	if len(warnings) != 1 || warnings[0].Code != WarningGzipNotCompressed {
+		t.Errorf("want %s warning, got %+v", WarningGzipNotCompressed, warnings)
+	}
+}
+
+func TestClientBOM(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	resp, err := NewClient(ts.URL+"/bom", false, nil).Call("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != personEnvelope {
+		t.Errorf("want BOM stripped, got %q", resp)
+	}
+	if resp, err = NewClient(ts.URL+"/bom", false, nil, KeepBOM()).Call("", testRequest{Message: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != "\uFEFF"+personEnvelope {
+		t.Errorf("want BOM kept, got %q", resp)
+	}
+}
+
+func TestClientGzipSniffing(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	resp, err := NewClient(ts.URL+"/gzipbare", false, nil).Call("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) == personEnvelope {
+		t.Error("want body left compressed without sniffing")
+	}
+	var warnings []Warning
+	client := NewClient(ts.URL+"/gzipbare", false, nil, WithGzipSniffing(), OnWarning(func(w Warning) {
+		warnings = append(warnings, w)
+	}))
+	if resp, err = client.Call("", testRequest{Message: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != personEnvelope {
+		t.Errorf("want %s, got %q", personEnvelope, resp)
+	}
+	if len(warnings) != 1 || warnings[0].Code != WarningGzipUnadvertised {
+		t.Errorf("want %s warning, got %+v", WarningGzipUnadvertised, warnings)
+	}
+	warnings = nil
+	client = NewClient(ts.URL+"/noheader", false, nil, WithGzipSniffing(), OnWarning(func(w Warning) {
+		warnings = append(warnings, w)
+	}))
+	if _, err := client.Call("", testRequest{Message: "test"}); err != nil || len(warnings) != 0 {
+		t.Errorf("want plain body passed through, got %v, %+v", err, warnings)
+	}
+}
+
+func TestClientChunkedResponse(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	req := testRequest{Message: "test"}
+	res, err := NewClient(ts.URL+"/chunked", false, nil).CallFull("", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Body) != personEnvelope {
+		t.Errorf("want the whole envelope, got\n%s", res.Body)
+	}
+	if res.Header.Get("Content-Length") != "" {
+		t.Errorf("want a chunked response, got Content-Length %s", res.Header.Get("Content-Length"))
+	}
+
+	for _, path := range []string{"/chunked", "/noheader", "/gzip"} {
+		client := NewClient(ts.URL+path, false, nil, WithMaxResponseSize(64))
+		if _, err := client.Call("", req); !errors.Is(err, ErrResponseTooLarge) {
+			t.Errorf("%s: want ErrResponseTooLarge, got %v", path, err)
+		}
+	}
+	client := NewClient(ts.URL+"/chunked", false, nil, WithMaxResponseSize(int64(len(personEnvelope))))
+	if _, err := client.Call("", req); err != nil {
+		t.Errorf("want a body of exactly the maximum size accepted, got %v", err)
+	}
+}
+
+func TestClientCallFault(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+	ok := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(faultEnvelope))
+	}))
+	defer ok.Close()
+
+	req := testRequest{Message: "test"}
+	for _, url := range []string{ts.URL + "/fault", ok.URL} {
+		var fault Fault
+		resp, err := NewClient(url, false, nil).CallFault("", req, &fault)
+		if err != nil {
+			t.Fatalf("%s: want fault as data, got %v", url, err)
+		}
+		if fault.String != "Something went wrong" || string(resp) != faultEnvelope {
+			t.Errorf("%s: unexpected fault %+v with body %s", url, fault, resp)
+		}
+	}
+
+	var fault Fault
+	if _, err := NewClient(ts.URL+"/noheader", false, nil).CallFault("", req, &fault); err != nil || fault.Code != "" {
+		t.Errorf("want no fault, got %+v: %v", fault, err)
+	}
+	if _, err := NewClient(ts.URL+"/fault", false, nil).Call("", req); err == nil {
+		t.Error("want Call to keep returning faults as errors")
+	}
+}
+
+func TestClientResponseTrailer(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Status")
+		w.Write([]byte(personEnvelope))
+		w.Header().Set("X-Status", "done")
+	}))
+	defer ts.Close()
+
+	res, err := NewClient(ts.URL, false, nil).CallFull("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := res.Trailer.Get("X-Status"); got != "done" {
+		t.Errorf("want trailer X-Status done, got %q", got)
+	}
+}
+
+func TestClientResponseDate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Date", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+		w.Write([]byte(personEnvelope))
+	}))
+	defer ts.Close()
+
+	res, err := NewClient(ts.URL, false, nil).CallFull("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Sent.IsZero() || res.Received.Before(res.Sent) {
+		t.Errorf("unexpected exchange times %v %v", res.Sent, res.Received)
+	}
+	if offset := res.ServerOffset(); offset < time.Hour-2*time.Second || offset > time.Hour+time.Second {
+		t.Errorf("want server an hour ahead, got %v", offset)
+	}
+}
+
+func TestClientSkipResponseBody(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	req := testRequest{Message: "test"}
+	client := NewClient(ts.URL+"/chunked", false, nil, SkipResponseBody())
+	res, err := client.CallFull("", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || res.Body != nil {
+		t.Errorf("want status 200 without body, got %d %q", res.StatusCode, res.Body)
+	}
+
+	client = NewClient(ts.URL+"/fault", false, nil, SkipResponseBody())
+	var httpErr *HTTPError
+	if _, err := client.Call("", req); !errors.As(err, &httpErr) || httpErr.Fault == nil {
+		t.Errorf("want fault still read, got %v", err)
+	}
+}
+
+func TestClientHTTPErrorWithFault(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	url := ts.URL + "/fault"
+	client := NewClient(url, false, nil)
+	_, err := client.Call(url, testRequest{Message: "test"})
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("want *HTTPError, got %v", err)
+	}
+	if httpErr.StatusCode != http.StatusInternalServerError {
+		t.Errorf("want status 500, got %d", httpErr.StatusCode)
+	}
+	if httpErr.Header.Get("X-Request-Id") != "42" {
+		t.Errorf("want X-Request-Id header, got %v", httpErr.Header)
+	}
+	if string(httpErr.Body) != faultEnvelope {
+		t.Errorf("want raw body %s, got %s", faultEnvelope, httpErr.Body)
+	}
+
+	var fault *Fault
+	if !errors.As(err, &fault) {
+		t.Fatalf("want *Fault, got %v", err)
+	}
+	if fault != httpErr.Fault {
+		t.Error("want unwrapped fault to be HTTPError.Fault")
+	}
+	if fault.Code != "soap:Server" || fault.String != "Something went wrong" ||
+		fault.Actor != "Actor" || fault.Detail != "details" {
+		t.Errorf("unexpected fault %+v", fault)
+	}
+}
+
+func TestClientHTTPErrorWithoutFault(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	url := ts.URL + "/notfound"
+	client := NewClient(url, false, nil)
+	_, err := client.Call(url, testRequest{Message: "test"})
+
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("want *HTTPError, got %v", err)
+	}
+	if httpErr.StatusCode != http.StatusNotFound || httpErr.Fault != nil {
+		t.Errorf("want 404 without fault, got %d %+v", httpErr.StatusCode, httpErr.Fault)
+	}
+	var fault *Fault
+	if errors.As(err, &fault) {
+		t.Error("want no *Fault in chain")
+	}
+}
+
+func TestClientCallRawBytes(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	url := ts.URL + "/echo"
+	client := NewClient(url, false, nil)
+	envelope := []byte(personEnvelope)
+	resp, err := client.CallRaw("urn:replay", envelope, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(resp) != personEnvelope {
+		t.Errorf("want envelope sent verbatim, got %s", resp)
+	}
+}
+
+func TestClientDryRun(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	seq, err := NewReliableSequence("urn:seq:1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := ts.URL + "/echo"
+	header := myRequestHeader{UserID: "myname", Password: "pass"}
+	client := NewClient(url, false, header, WithReliableSequence(seq))
+	req := testRequest{Message: "test"}
+
+	dry, err := client.DryRun("urn:action", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dry.Method != "POST" || dry.URL.String() != url {
+		t.Errorf("unexpected request line %s %s", dry.Method, dry.URL)
+	}
+	if dry.Header.Get("SOAPAction") != "urn:action" ||
+		!strings.HasPrefix(dry.Header.Get("Content-Type"), "text/xml") {
+		t.Errorf("unexpected headers %v", dry.Header)
+	}
+	body, err := ioutil.ReadAll(dry.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq.MessageNumber() != 0 {
+		t.Errorf("want dry run to leave the sequence untouched, got %d", seq.MessageNumber())
+	}
+
+	sent, err := client.Call("urn:action", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(sent) != string(body) {
+		t.Errorf("dry run body differs from sent body:\n%s\n%s", body, sent)
+	}
+}
+
+func TestClientContentTypeAction(t *testing.T) {
+	action := `urn:DoThing"quoted"`
+	for _, enabled := range []bool{false, true} {
+		var opts []Option
+		if enabled {
+			opts = append(opts, WithContentTypeAction())
+		}
+		client := NewClient("http://localhost/", false, nil, opts...)
+		req, err := client.DryRun(action, testRequest{Message: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mediaType != "text/xml" || params["charset"] != "utf-8" {
+			t.Errorf("unexpected Content-Type %s", req.Header.Get("Content-Type"))
+		}
+		if got, ok := params["action"]; ok != enabled || (enabled && got != action) {
+			t.Errorf("enabled %v: unexpected action parameter %q", enabled, got)
+		}
+		if req.Header.Get("SOAPAction") != action {
+			t.Errorf("want SOAPAction header kept, got %q", req.Header.Get("SOAPAction"))
+		}
+	}
+}
+
+func TestClientRequireSOAPAction(t *testing.T) {
+	var hits int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Write([]byte(personEnvelope))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, false, nil, RequireSOAPAction())
+	if _, err := client.Call("", testRequest{Message: "test"}); err != ErrSOAPActionRequired {
+		t.Errorf("want ErrSOAPActionRequired, got %v", err)
+	}
+	if hits != 0 {
+		t.Errorf("want no request sent, got %d", hits)
+	}
+	if _, err := client.Call("urn:DoThing", testRequest{Message: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.CallRaw("", []byte(personEnvelope), map[string]string{"SOAPAction": "urn:DoThing"}); err != nil {
+		t.Errorf("want action from headers accepted, got %v", err)
+	}
+}
+
+type getOrder struct {
+	XMLName xml.Name `xml:"urn:orders GetOrder"`
+	ID      int      `xml:"id"`
+}
+
+func (getOrder) SOAPAction() string {
+	return SOAPAction("urn:orders", "GetOrder")
+}
+
+func TestClientRequireMatchingSOAPAction(t *testing.T) {
+	client := NewClient("http://localhost/", false, nil, RequireMatchingSOAPAction())
+	if _, err := client.DryRun("urn:orders/CancelOrder", getOrder{ID: 1}); !errors.Is(err, ErrSOAPActionMismatch) {
+		t.Errorf("want ErrSOAPActionMismatch, got %v", err)
+	}
+	for _, action := range []string{"urn:orders/GetOrder", `"urn:orders/GetOrder"`} {
+		if _, err := client.DryRun(action, InNamespace("urn:orders:v2", getOrder{ID: 1})); err != nil {
+			t.Errorf("%s: want matching action accepted, got %v", action, err)
+		}
+	}
+	if _, err := client.DryRun("urn:anything", testRequest{Message: "test"}); err != nil {
+		t.Errorf("want request without declared action sent, got %v", err)
+	}
+}
+
+func TestClientBodyFirst(t *testing.T) {
+	for _, bodyFirst := range []bool{false, true} {
+		opts := []Option{}
+		if bodyFirst {
+			opts = append(opts, WithBodyFirst())
+		}
+		client := NewClient("http://localhost/", false, myRequestHeader{UserID: "myname"}, opts...)
+		req, err := client.DryRun("", testRequest{Message: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, body := bytes.Index(b, []byte("<Header")), bytes.Index(b, []byte("<Body"))
+		if header < 0 || body < 0 || (body < header) != bodyFirst {
+			t.Errorf("body first %v: unexpected order\n%s", bodyFirst, b)
+		}
+	}
+}
+
+func TestClientURLResolver(t *testing.T) {
+	stable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(personEnvelope))
+	}))
+	defer stable.Close()
+	canary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer canary.Close()
+
+	var messages []string
+	client := NewClient(stable.URL, false, nil, WithURLResolver(func(soapAction string, request interface{}) (string, error) {
+		messages = append(messages, request.(testRequest).Message)
+		switch soapAction {
+		case "urn:Canary":
+			return canary.URL, nil
+		case "urn:Unknown":
+			return "", errors.New("no route")
+		}
+		return stable.URL, nil
+	}))
+	if _, err := client.Call("urn:Stable", testRequest{Message: "stable"}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := client.Call("urn:Canary", testRequest{Message: "canary"})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.URL != canary.URL {
+		t.Errorf("want error from %s, got %v", canary.URL, err)
+	}
+	if _, err := client.Call("urn:Unknown", testRequest{Message: "unknown"}); err == nil || !strings.Contains(err.Error(), "no route") {
+		t.Errorf("want resolver error, got %v", err)
+	}
+	if strings.Join(messages, ",") != "stable,canary,unknown" {
+		t.Errorf("want operation requests passed to the resolver, got %v", messages)
+	}
+}
+
+func TestClientConnection(t *testing.T) {
+	for value, wantClose := range map[string]bool{"": false, "keep-alive": false, "close": true, "Close": true} {
+		var opts []Option
+		if value != "" {
+			opts = append(opts, WithConnection(value))
+		}
+		client := NewClient("http://localhost/", false, nil, opts...)
+		req, err := client.DryRun("", testRequest{Message: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.Header.Get("Connection") != value || req.Close != wantClose {
+			t.Errorf("%q: unexpected Connection %q, close %v", value, req.Header.Get("Connection"), req.Close)
+		}
+	}
+
+	client := NewClient("http://localhost/", false, nil, WithConnection("keep-alive"), WithHeaders(map[string]string{"Connection": "close"}))
+	req, err := client.DryRun("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !req.Close {
+		t.Error("want close from the header finally sent")
+	}
+}
+
+func TestClientRequestCompression(t *testing.T) {
+	large := testRequest{Message: strings.Repeat("x", 4096)}
+	client := NewClient("http://localhost/", false, nil, WithRequestCompression(1024))
+	for _, request := range []testRequest{{Message: "test"}, large} {
+		req, err := client.DryRun("", request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.Header.Get("Content-Length") != strconv.Itoa(len(b)) {
+			t.Errorf("Content-Length %s for %d bytes", req.Header.Get("Content-Length"), len(b))
+		}
+		gzipped := req.Header.Get("Content-Encoding") == "gzip"
+		if gzipped != (request == large) {
+			t.Errorf("message of %d bytes: unexpected Content-Encoding %q", len(request.Message), req.Header.Get("Content-Encoding"))
+		}
+		if !gzipped {
+			continue
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b, err = ioutil.ReadAll(zr); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(b, []byte(large.Message)) {
+			t.Errorf("compressed body lacks the message\n%s", b)
+		}
+	}
+}
+
+func TestClientIdentityEncoding(t *testing.T) {
+	var accepted string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accepted = r.Header.Get("Accept-Encoding")
+		w.Write([]byte(personEnvelope))
+	}))
+	defer ts.Close()
+
+	if _, err := NewClient(ts.URL, false, nil).Call("", testRequest{Message: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if accepted != "gzip" {
+		t.Errorf("want gzip accepted by default, got %q", accepted)
+	}
+	if _, err := NewClient(ts.URL, false, nil, WithIdentityEncoding()).Call("", testRequest{Message: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if accepted != "identity" {
+		t.Errorf("want identity encoding, got %q", accepted)
+	}
+}
+
+func TestClientTrailer(t *testing.T) {
+	for _, trailer := range []string{"", "\n", "\r\n"} {
+		client := NewClient("http://localhost/", false, nil, WithTrailer(trailer))
+		req, err := client.DryRun("", testRequest{Message: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "</Envelope>" + trailer
+		if !strings.HasSuffix(string(b), want) {
+			t.Errorf("want body ending with %q, got %q", want, b)
+		}
+		if strings.Contains(strings.SplitN(string(b), "\n", 2)[1], "\n  ") {
+			t.Errorf("want compact body, got %q", b)
+		}
+		if req.Header.Get("Content-Length") != strconv.Itoa(len(b)) {
+			t.Errorf("want Content-Length %d, got %s", len(b), req.Header.Get("Content-Length"))
+		}
+	}
+}
+
+func TestClientProcessingInstruction(t *testing.T) {
+	client := NewClient("http://localhost/", false, nil,
+		WithProcessingInstruction("xml-stylesheet", `type="text/xsl" href="soap.xsl"`),
+		WithProcessingInstruction("partner", "v2"))
+	req, err := client.DryRun("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<?xml version="1.0" encoding="UTF-8"?>` + "\n" +
+		`<?xml-stylesheet type="text/xsl" href="soap.xsl"?>` + "\n<?partner v2?>\n<Envelope"
+	if !strings.HasPrefix(string(b), want) {
+		t.Errorf("want body starting with %q, got %q", want, b)
+	}
+
+	for _, target := range []string{"XML", "bad target"} {
+		client = NewClient("http://localhost/", false, nil, WithProcessingInstruction(target, ""))
+		if _, err := client.DryRun("", testRequest{Message: "test"}); err == nil {
+			t.Errorf("want target %q rejected", target)
+		}
+	}
+}
+
+func TestClientCRLF(t *testing.T) {
+	client := NewClient("http://localhost/", false, RawXML("\n<a>1</a>\n<b>2</b>\r\n"), WithCRLF(), WithTrailer("\n"))
+	req, err := client.DryRun("", testRequest{Message: "line\nbreak"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := strings.TrimSuffix(string(b), "\n")
+	if strings.Count(body, "\r\n") != strings.Count(body, "\n") || strings.Count(body, "\r\n") != 4 {
+		t.Errorf("want every line ended with CRLF, got %q", b)
+	}
+	if !strings.Contains(body, "line&#xA;break") || !strings.HasSuffix(string(b), "</Envelope>\n") {
+		t.Errorf("want content and trailer unchanged, got %q", b)
+	}
+}
+
+type rawNote struct {
+	XMLName xml.Name `xml:"note"`
+	Content []byte   `xml:",innerxml"`
+}
+
+func TestClientCRLFRaw(t *testing.T) {
+	client := NewClient("http://localhost/", false, RawXML("<h>x\ny</h>"), WithCRLF())
+	req, err := client.DryRun("", rawNote{Content: []byte("<p>a\nb</p>")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "<h>x\r\ny</h>") || !strings.Contains(string(b), "<p>a\r\nb</p>") {
+		t.Errorf("want bare LF of raw content rewritten, got %q", b)
+	}
+	var env struct {
+		Header struct {
+			H string `xml:"h"`
+		}
+		Body struct {
+			Note struct {
+				P string `xml:"p"`
+			} `xml:"note"`
+		}
+	}
+	if err := xml.Unmarshal(b, &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.Header.H != "x\ny" || env.Body.Note.P != "a\nb" {
+		t.Errorf("want raw content read back with LF, got %q and %q", env.Header.H, env.Body.Note.P)
+	}
+}
+
+func TestClientSocketOptions(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	opts := SocketOptions{Nagle: true, ReadBuffer: 64 << 10, WriteBuffer: 64 << 10}
+	client := NewClient(ts.URL+"/noheader", false, nil, WithSocketOptions(opts))
+	if _, err := client.Call("", testRequest{Message: "test"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientKeepAlive(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	client := NewClient(ts.URL+"/noheader", false, nil, WithKeepAlive(time.Minute, 10*time.Second))
+	if _, err := client.Call("", testRequest{Message: "test"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientDSCP(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("DSCP marking not supported on", runtime.GOOS)
+	}
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	client := NewClient(ts.URL+"/noheader", false, nil, WithDSCP(46))
+	if _, err := client.Call("", testRequest{Message: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	client = NewClient(ts.URL+"/noheader", false, nil, WithDSCP(64))
+	if _, err := client.Call("", testRequest{Message: "test"}); err == nil || !strings.Contains(err.Error(), "invalid DSCP") {
+		t.Errorf("want invalid DSCP rejected, got %v", err)
+	}
+}
+
+func TestClientTransportErrorKind(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	refused := "http://" + l.Addr().String()
+	l.Close()
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(200 * time.Millisecond):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	secure := httptest.NewTLSServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer secure.Close()
+	junk, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer junk.Close()
+	go func() {
+		for {
+			conn, err := junk.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("not a TLS server\r\n"))
+			conn.Close()
+		}
+	}()
+
+	for _, tc := range []struct {
+		name string
+		url  string
+		opts []Option
+		kind TransportErrorKind
+	}{
+		{"refused", refused, nil, TransportRefused},
+		{"timeout", slow.URL, []Option{WithTimeouts(20*time.Millisecond, nil)}, TransportTimeout},
+		{"timeout with retries", slow.URL, []Option{WithTimeouts(30*time.Millisecond, nil), WithRetry(3, time.Millisecond)}, TransportTimeout},
+		{"refused with retries", refused, []Option{WithRetry(3, time.Millisecond)}, TransportRefused},
+		{"untrusted certificate", secure.URL, nil, TransportTLS},
+		{"server not speaking TLS", "https://" + junk.Addr().String(), nil, TransportTLS},
+	} {
+		_, err := NewClient(tc.url, false, nil, tc.opts...).Call("", testRequest{Message: "test"})
+		var transportErr *TransportError
+		if !errors.As(err, &transportErr) || transportErr.Kind != tc.kind {
+			t.Errorf("%s: want %s transport error, got %v", tc.name, tc.kind, err)
+		}
+	}
+}
+
+func TestClientUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "soap.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Skip(err)
+	}
+	ts := httptest.NewUnstartedServer(testsvr.NewMux(DefaultHandlerMap, t))
+	ts.Listener.Close()
+	ts.Listener = l
+	ts.Start()
+	defer ts.Close()
+
+	client := NewClient("http://localhost/noheader", false, nil, WithUnixSocket(path))
+	resp, err := client.Call("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(resp, []byte("<person>")) {
+		t.Errorf("unexpected response %s", resp)
+	}
+}
+
+func TestClientSuccessStatus(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(250)
+		w.Write([]byte(personEnvelope))
+	}))
+	defer ts.Close()
+
+	req := testRequest{Message: "test"}
+	var httpErr *HTTPError
+	if _, err := NewClient(ts.URL, false, nil).Call("", req); !errors.As(err, &httpErr) || httpErr.StatusCode != 250 {
+		t.Errorf("want HTTPError with status 250 by default, got %v", err)
+	}
+	res, err := NewClient(ts.URL, false, nil, WithSuccessStatus(200, 250)).Call("", req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(res), "<person>") {
+		t.Errorf("want response body, got %s", res)
+	}
+}
+
+func TestClientBodyDigest(t *testing.T) {
+	var (
+		body   []byte
+		header http.Header
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = ioutil.ReadAll(r.Body)
+		header = r.Header
+		w.Write([]byte(personEnvelope))
+	}))
+	defer ts.Close()
+
+	cases := []struct {
+		header    string
+		algorithm DigestAlgorithm
+		digest    func([]byte) string
+	}{
+		{
+			header:    "Content-MD5",
+			algorithm: DigestMD5,
+			digest: func(b []byte) string {
+				sum := md5.Sum(b)
+				return base64.StdEncoding.EncodeToString(sum[:])
+			},
+		},
+		{
+			header:    "Digest",
+			algorithm: DigestSHA256,
+			digest: func(b []byte) string {
+				sum := sha256.Sum256(b)
+				return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+			},
+		},
+	}
+	for _, c := range cases {
+		client := NewClient(ts.URL, false, nil, WithBodyDigest(c.header, c.algorithm), WithTrailer("\n"))
+		if _, err := client.Call("", testRequest{Message: "test"}); err != nil {
+			t.Fatal(err)
+		}
+		if want := c.digest(body); header.Get(c.header) != want {
+			t.Errorf("%s: want %s for the transmitted body, got %s", c.header, want, header.Get(c.header))
+		}
+	}
+}
+
+func TestSOAPAction(t *testing.T) {
+	cases := []struct {
+		namespace, operation, expected string
+	}{
+		{"http://example.com/orders", "GetOrder", `"http://example.com/orders/GetOrder"`},
+		{"http://example.com/orders/", "GetOrder", `"http://example.com/orders/GetOrder"`},
+		{"http://example.com/orders//", "/GetOrder", `"http://example.com/orders/GetOrder"`},
+		{"urn:orders", "GetOrder", `"urn:orders/GetOrder"`},
+		{"", "GetOrder", `"GetOrder"`},
+	}
+	for _, c := range cases {
+		if got := SOAPAction(c.namespace, c.operation); got != c.expected {
+			t.Errorf("SOAPAction(%q, %q): want %s, got %s", c.namespace, c.operation, c.expected, got)
+		}
+	}
+
+	client := NewClient("http://localhost/", false, nil, WithContentTypeAction())
+	req, err := client.DryRun(SOAPAction("urn:orders", "GetOrder"), testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("SOAPAction"); got != `"urn:orders/GetOrder"` {
+		t.Errorf("want quoted SOAPAction header, got %s", got)
+	}
+	if _, params, _ := mime.ParseMediaType(req.Header.Get("Content-Type")); params["action"] != "urn:orders/GetOrder" {
+		t.Errorf("want unquoted action parameter, got %q", params["action"])
+	}
+}
+
+func TestMatchSOAPAction(t *testing.T) {
+	cases := []struct {
+		received, expected string
+		foldCase, match    bool
+	}{
+		{`"urn:orders/GetOrder"`, "urn:orders/GetOrder", false, true},
+		{` urn:orders/GetOrder `, `"urn:orders/GetOrder"`, false, true},
+		{"\t\"urn:orders/GetOrder\" ", "urn:orders/GetOrder", false, true},
+		{"urn:Orders/getOrder", "urn:orders/GetOrder", false, false},
+		{`"urn:Orders/getOrder"`, "urn:orders/GetOrder", true, true},
+		{"urn:orders/GetOrders", "urn:orders/GetOrder", true, false},
+		{`""`, "", false, true},
+	}
+	for _, c := range cases {
+		if got := MatchSOAPAction(c.received, c.expected, c.foldCase); got != c.match {
+			t.Errorf("MatchSOAPAction(%q, %q, %v): want %v", c.received, c.expected, c.foldCase, c.match)
+		}
+	}
+}
+
+func TestClientEmptyElements(t *testing.T) {
+	for _, form := range []EmptyElementForm{EmptyExplicit, EmptySelfClosing} {
+		client := NewClient("http://localhost/", false, nil, WithEmptyElements(form))
+		req, err := client.DryRun("", testRequest{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "<message></message>"
+		if form == EmptySelfClosing {
+			want = "<message/>"
+		}
+		if !strings.Contains(string(b), want) {
+			t.Errorf("want %s in\n%s", want, b)
+		}
+		if req.Header.Get("Content-Length") != strconv.Itoa(len(b)) {
+			t.Errorf("want Content-Length %d, got %s", len(b), req.Header.Get("Content-Length"))
+		}
+	}
+}
+
+const laughsEnvelope = `<?xml version="1.0"?>
+<!DOCTYPE lolz [
+  <!ENTITY lol "lol">
+  <!ENTITY lol1 "&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;&lol;">
+  <!ENTITY lol2 "&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;&lol1;">
+]>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><person><name><first>&lol2;</first></name></person></soap:Body></soap:Envelope>`
+
+func TestClientRejectsDTD(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(laughsEnvelope))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, false, nil)
+	if _, err := client.Call("", testRequest{Message: "test"}); err != ErrDTDNotAllowed {
+		t.Errorf("want ErrDTDNotAllowed, got %v", err)
+	}
+	var p person
+	if err := DecodeResponse(strings.NewReader(laughsEnvelope), nil, &p); err != ErrDTDNotAllowed {
+		t.Errorf("DecodeResponse: want ErrDTDNotAllowed, got %v", err)
+	}
+}
+
+func TestClientRequireUTF8(t *testing.T) {
+	responses := map[string]struct {
+		contentType, body string
+	}{
+		"/utf8":     {"text/xml; charset=utf-8", personEnvelope},
+		"/header":   {"text/xml; charset=ISO-8859-1", personEnvelope},
+		"/declared": {"text/xml", "<?xml version=\"1.0\" encoding='ISO-8859-1'?><Envelope><Body><name>Jos\xe9</name></Body></Envelope>"},
+		"/latin1":   {"text/xml", "<Envelope><Body><name>Jos\xe9</name></Body></Envelope>"},
+	}
+	var acceptCharset string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptCharset = r.Header.Get("Accept-Charset")
+		res := responses[r.URL.Path]
+		w.Header().Set("Content-Type", res.contentType)
+		w.Write([]byte(res.body))
+	}))
+	defer ts.Close()
+
+	for path := range responses {
+		_, err := NewClient(ts.URL+path, false, nil, RequireUTF8()).Call("", testRequest{Message: "test"})
+		if (path == "/utf8") != (err == nil) || (err != nil && !errors.Is(err, ErrNotUTF8)) {
+			t.Errorf("%s: unexpected error %v", path, err)
+		}
+		if acceptCharset != "utf-8" {
+			t.Errorf("%s: want Accept-Charset utf-8, got %q", path, acceptCharset)
+		}
+	}
+
+	if _, err := NewClient(ts.URL+"/header", false, nil, WithAcceptCharset("utf-8, iso-8859-1;q=0.5")).Call("", testRequest{Message: "test"}); err != nil {
+		t.Errorf("want charsets accepted without RequireUTF8, got %v", err)
+	}
+	if acceptCharset != "utf-8, iso-8859-1;q=0.5" {
+		t.Errorf("unexpected Accept-Charset %q", acceptCharset)
+	}
+}
+
+func TestClientInvalidUTF8(t *testing.T) {
+	body := strings.Replace(personEnvelope, "Moga", "Mo\xffga", 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	res, err := NewClient(ts.URL, false, nil).Call("", testRequest{Message: "test"})
+	if err != nil || string(res) != body {
+		t.Errorf("want body passed as is, got %v", err)
+	}
+
+	res, err = NewClient(ts.URL, false, nil, WithInvalidUTF8(InvalidUTF8Replace)).Call("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p person
+	if err := DecodeResponse(bytes.NewReader(res), nil, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Name.First != "Mo\uFFFDga" {
+		t.Errorf("want invalid byte replaced, got %q", p.Name.First)
+	}
+
+	_, err = NewClient(ts.URL, false, nil, WithInvalidUTF8(InvalidUTF8Reject)).Call("", testRequest{Message: "test"})
+	var utf8Err *InvalidUTF8Error
+	if !errors.As(err, &utf8Err) {
+		t.Fatalf("want *InvalidUTF8Error, got %v", err)
+	}
+	if utf8Err.Offset != strings.Index(body, "\xff") || !strings.Contains(utf8Err.Snippet, "<first>Mo\xffga") {
+		t.Errorf("unexpected error %v", utf8Err)
+	}
+}
+
+func TestClientWarnings(t *testing.T) {
+	responses := map[string]struct {
+		status int
+		body   string
+	}{
+		"/lowercase": {http.StatusInternalServerError,
+			`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+				`<soap:fault><faultstring>x</faultstring></soap:fault></soap:Body></soap:Envelope>`},
+		"/comment": {http.StatusOK, "<?xml version=\"1.0\"?>\n<!-- generated -->\n" + strings.SplitN(personEnvelope, "\n", 2)[1]},
+		"/latin1":  {http.StatusOK, "<Envelope><Body><name>Jos\xe9</name></Body></Envelope>"},
+		"/declared": {http.StatusOK,
+			"<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?><Envelope><Body><name>Jos\xe9</name></Body></Envelope>"},
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := responses[r.URL.Path]
+		w.WriteHeader(res.status)
+		w.Write([]byte(res.body))
+	}))
+	defer ts.Close()
+
+	expected := map[string]string{
+		"/lowercase": WarningNonStandardFault,
+		"/comment":   WarningLeadingComment,
+		"/latin1":    WarningUndeclaredEncoding,
+		"/declared":  "",
+	}
+	for path, code := range expected {
+		var warnings []Warning
+		client := NewClient(ts.URL+path, false, nil,
+			WithFaultDetection(FaultDetectTolerant),
+			OnWarning(func(w Warning) {
+				warnings = append(warnings, w)
+			}))
+		client.Call("", testRequest{Message: "test"})
+		if code == "" {
+			if len(warnings) != 0 {
+				t.Errorf("%s: want no warnings, got %+v", path, warnings)
+			}
+			continue
+		}
+		if len(warnings) != 1 || warnings[0].Code != code || warnings[0].Message == "" {
+			t.Errorf("%s: want %s warning, got %+v", path, code, warnings)
+		}
+	}
+}
+
+var errServerBusy = errors.New("server busy")
+
+func TestClientFaultMapper(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	url := ts.URL + "/fault"
+	var mapped *Fault
+	client := NewClient(url, false, nil, WithFaultMapper(func(f *Fault) error {
+		mapped = f
+		if f.Code == "soap:Server" {
+			return errServerBusy
+		}
+		return nil
+	}))
+	_, err := client.Call(url, testRequest{Message: "test"})
+	if err != errServerBusy {
+		t.Fatalf("want mapped error, got %v", err)
+	}
+	if mapped == nil || mapped.String != "Something went wrong" {
+		t.Errorf("want mapper to receive the fault, got %+v", mapped)
+	}
+
+	client = NewClient(url, false, nil, WithFaultMapper(func(f *Fault) error {
+		return nil
+	}))
+	_, err = client.Call(url, testRequest{Message: "test"})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Errorf("want default *HTTPError when mapper returns nil, got %v", err)
+	}
+}
+
+func TestClientDefaultHeaders(t *testing.T) {
+	var received http.Header
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header
+		w.Write([]byte(personEnvelope))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, false, nil,
+		WithHeaders(map[string]string{"X-Api-Key": "secret", "X-Tenant": "a"}),
+		WithHeaders(map[string]string{"X-Tenant": "b", "X-Trace": "default"}))
+
+	if _, err := client.Call("urn:action", testRequest{Message: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"X-Api-Key":  "secret",
+		"X-Tenant":   "b",
+		"X-Trace":    "default",
+		"SOAPAction": "urn:action",
+	}
+	for key, value := range expected {
+		if received.Get(key) != value {
+			t.Errorf("%s: want %q, got %q", key, value, received.Get(key))
+		}
+	}
+
+	_, err := client.CallRaw("urn:action", Envelope{Body: Body{Content: testRequest{Message: "test"}}},
+		map[string]string{"X-Trace": "call", "SOAPAction": "urn:override"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected["X-Trace"] = "call"
+	expected["SOAPAction"] = "urn:override"
+	for key, value := range expected {
+		if received.Get(key) != value {
+			t.Errorf("%s: want %q, got %q", key, value, received.Get(key))
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package soap
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net"
+	"time"
+)
+
+// dialTimeout connection establishment timeout
+const dialTimeout = 30 * time.Second
+
+// SocketOptions TCP socket parameters applied to new connections
+type SocketOptions struct {
+	// Nagle enable Nagle's algorithm, which Go disables, coalescing small
+	// writes at the cost of latency
+	Nagle bool
+	// ReadBuffer, WriteBuffer socket buffer sizes in bytes, the operating
+	// system default when 0
+	ReadBuffer  int
+	WriteBuffer int
+}
+
+// WithSocketOptions set the TCP parameters of the connections dialed by
+// the client. Zero fields, like a client without it, keep the Go defaults,
+// Nagle's algorithm disabled.
+func WithSocketOptions(opts SocketOptions) Option {
+	return func(c *Client) {
+		c.socket = &opts
+	}
+}
+
+// WithKeepAlive send TCP keep-alive probes every interval once a
+// connection has been idle for idle, e.g. so that firewalls dropping
+// silent connections do not reap one waiting minutes for the response of a
+// long running operation. Probes are sent by the operating system, while
+// the request is in flight as well as between requests. Both are rounded
+// up to whole seconds, an interval of 0 meaning idle; interval is applied
+// on Linux only, elsewhere the Go default applies. Without it
+// the Go defaults apply, 15 seconds for both.
+func WithKeepAlive(idle, interval time.Duration) Option {
+	return func(c *Client) {
+		c.keepAlive = idle
+		c.keepAliveInterval = interval
+	}
+}
+
+// WithUnixSocket connect to the Unix domain socket at path instead of the
+// host of the URL, e.g. to reach a co-located SOAP daemon without opening a
+// network port. The URL still sets the path, and the Host header, of the
+// requests: use e.g. http://localhost/service.
+func WithUnixSocket(path string) Option {
+	return func(c *Client) {
+		c.unixSocket = path
+	}
+}
+
+// dial connect to addr, applying the client's socket options
+func (s *Client) dial(ctx context.Context, network, addr string) (net.Conn, error) {
+	if s.unixSocket != "" {
+		network, addr = "unix", s.unixSocket
+	}
+	dialer := net.Dialer{Timeout: dialTimeout, KeepAlive: s.keepAlive}
+	if s.dscp != 0 && network != "unix" {
+		dialer.Control = s.controlDSCP
+	}
+	conn, err := dialer.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	tcp, ok := conn.(*net.TCPConn)
+	if !ok {
+		return conn, nil
+	}
+	if s.keepAlive > 0 {
+		// the interval the dialer sets depends on the Go version
+		interval := s.keepAliveInterval
+		if interval <= 0 {
+			interval = s.keepAlive
+		}
+		err = controlConn(tcp, func(fd uintptr) error {
+			return setKeepAliveInterval(fd, interval)
+		})
+	}
+	if err == nil && s.socket != nil {
+		err = s.applySocketOptions(tcp)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// applySocketOptions set the client's socket options on tcp
+func (s *Client) applySocketOptions(tcp *net.TCPConn) error {
+	var err error
+	if s.socket.Nagle {
+		err = tcp.SetNoDelay(false)
+	}
+	if err == nil && s.socket.ReadBuffer > 0 {
+		err = tcp.SetReadBuffer(s.socket.ReadBuffer)
+	}
+	if err == nil && s.socket.WriteBuffer > 0 {
+		err = tcp.SetWriteBuffer(s.socket.WriteBuffer)
+	}
+	return err
+}
+
+// controlConn run f on the file descriptor of tcp
+func controlConn(tcp *net.TCPConn, f func(fd uintptr) error) error {
+	raw, err := tcp.SyscallConn()
+	if err != nil {
+		return err
+	}
+	if cerr := raw.Control(func(fd uintptr) {
+		err = f(fd)
+	}); cerr != nil {
+		return cerr
+	}
+	return err
+}
+
+// TransportErrorKind class of failure of a TransportError
+type TransportErrorKind int
+
+const (
+	// TransportOther failure of no other kind, e.g. a connection reset
+	TransportOther TransportErrorKind = iota
+	// TransportRefused the server refused the connection, as when the
+	// backend is down
+	TransportRefused
+	// TransportTimeout a deadline expired, connecting or waiting for the
+	// response
+	TransportTimeout
+	// TransportTLS the TLS handshake failed, e.g. on a certificate that
+	// does not verify or a server not speaking TLS
+	TransportTLS
+)
+
+func (k TransportErrorKind) String() string {
+	switch k {
+	case TransportRefused:
+		return "refused"
+	case TransportTimeout:
+		return "timeout"
+	case TransportTLS:
+		return "tls"
+	}
+	return "other"
+}
+
+// TransportError failure to send a request or receive the response
+// header, classified by Kind
+type TransportError struct {
+	Kind TransportErrorKind
+	Err  error
+}
+
+func (e *TransportError) Error() string {
+	return "failed to send SOAP request: " + e.Err.Error()
+}
+
+// Unwrap return the underlying error
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
+// transportErrorKind classify err returned by the HTTP client
+func transportErrorKind(err error) TransportErrorKind {
+	var (
+		netErr    net.Error
+		alert     tls.AlertError
+		record    tls.RecordHeaderError
+		verify    *tls.CertificateVerificationError
+		authority x509.UnknownAuthorityError
+		hostname  x509.HostnameError
+		invalid   x509.CertificateInvalidError
+	)
+	switch {
+	case isConnRefused(err):
+		return TransportRefused
+	case errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout():
+		return TransportTimeout
+	case errors.As(err, &alert) || errors.As(err, &record) || errors.As(err, &verify) ||
+		errors.As(err, &authority) || errors.As(err, &hostname) || errors.As(err, &invalid):
+		return TransportTLS
+	}
+	return TransportOther
+}
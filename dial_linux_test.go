@@ -0,0 +1,82 @@
+package soap
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// dialed return a connection dialed by s to a local listener
+func dialed(t *testing.T, s *Client) *net.TCPConn {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	conn, err := s.dial(context.Background(), "tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn.(*net.TCPConn)
+}
+
+// sockopt return the integer socket option opt at level of conn
+func sockopt(t *testing.T, conn *net.TCPConn, level, opt int) int {
+	var v int
+	err := controlConn(conn, func(fd uintptr) (err error) {
+		v, err = syscall.GetsockoptInt(int(fd), level, opt)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestDialKeepAlive(t *testing.T) {
+	conn := dialed(t, NewClient("", false, nil, WithKeepAlive(time.Minute, 10*time.Second)))
+	if v := sockopt(t, conn, syscall.SOL_SOCKET, syscall.SO_KEEPALIVE); v == 0 {
+		t.Error("want keep-alive enabled")
+	}
+	if v := sockopt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE); v != 60 {
+		t.Errorf("want idle time of 60s, got %ds", v)
+	}
+	if v := sockopt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL); v != 10 {
+		t.Errorf("want interval of 10s, got %ds", v)
+	}
+
+	conn = dialed(t, NewClient("", false, nil, WithKeepAlive(1500*time.Millisecond, 0)))
+	if idle, interval := sockopt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPIDLE),
+		sockopt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL); idle != 2 || interval != 2 {
+		t.Errorf("want idle time used as interval, rounded up, got %ds and %ds", idle, interval)
+	}
+}
+
+func TestDialSocketOptions(t *testing.T) {
+	conn := dialed(t, NewClient("", false, nil, WithSocketOptions(SocketOptions{ReadBuffer: 64 << 10})))
+	if v := sockopt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY); v == 0 {
+		t.Error("want Nagle's algorithm left disabled")
+	}
+	if v := sockopt(t, conn, syscall.SOL_SOCKET, syscall.SO_RCVBUF); v < 64<<10 {
+		t.Errorf("want a receive buffer of at least 64KiB, got %d", v)
+	}
+
+	conn = dialed(t, NewClient("", false, nil, WithSocketOptions(SocketOptions{Nagle: true})))
+	if v := sockopt(t, conn, syscall.IPPROTO_TCP, syscall.TCP_NODELAY); v != 0 {
+		t.Error("want Nagle's algorithm enabled")
+	}
+}
+
+func TestDialDSCP(t *testing.T) {
+	conn := dialed(t, NewClient("", false, nil, WithDSCP(46)))
+	if v := sockopt(t, conn, syscall.IPPROTO_IP, syscall.IP_TOS); v != 46<<2 {
+		t.Errorf("want TOS %#x for expedited forwarding, got %#x", 46<<2, v)
+	}
+	conn = dialed(t, NewClient("", false, nil))
+	if v := sockopt(t, conn, syscall.IPPROTO_IP, syscall.IP_TOS); v != 0 {
+		t.Errorf("want packets left unmarked, got TOS %#x", v)
+	}
+}
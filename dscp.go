@@ -0,0 +1,42 @@
+package soap
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+// WithDSCP mark the IP packets of the connections dialed by the client
+// with the Differentiated Services code point dscp, 0 to 63, e.g. 46 for
+// expedited forwarding, so that QoS managed networks prioritize them. The
+// code point is set through the IP_TOS or IPV6_TCLASS socket option,
+// supported on Linux and macOS; dialing fails on other systems. A code
+// point outside 0 to 63 fails every call, when dialing, with an invalid
+// DSCP error. Without it packets are not marked.
+func WithDSCP(dscp int) Option {
+	return func(c *Client) {
+		c.dscp = dscp
+	}
+}
+
+// controlDSCP set the traffic class of the socket dialed to address
+func (s *Client) controlDSCP(network, address string, conn syscall.RawConn) error {
+	if s.dscp < 0 || s.dscp > 63 {
+		return fmt.Errorf("invalid DSCP %d", s.dscp)
+	}
+	ipv6 := network == "tcp6"
+	if host, _, err := net.SplitHostPort(address); err == nil && network != "tcp4" {
+		ip := net.ParseIP(host)
+		ipv6 = ip != nil && ip.To4() == nil
+	}
+	var err error
+	if cerr := conn.Control(func(fd uintptr) {
+		err = setTrafficClass(fd, ipv6, s.dscp<<2)
+	}); cerr != nil {
+		return cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set DSCP: %w", err)
+	}
+	return nil
+}
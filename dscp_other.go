@@ -0,0 +1,10 @@
+//go:build !linux && !darwin
+
+package soap
+
+import "errors"
+
+// setTrafficClass report DSCP marking as unsupported
+func setTrafficClass(fd uintptr, ipv6 bool, class int) error {
+	return errors.New("DSCP marking is not supported on this system")
+}
@@ -0,0 +1,13 @@
+//go:build linux || darwin
+
+package soap
+
+import "syscall"
+
+// setTrafficClass set the IPv4 TOS or IPv6 traffic class of socket fd
+func setTrafficClass(fd uintptr, ipv6 bool, class int) error {
+	if ipv6 {
+		return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, class)
+	}
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, class)
+}
@@ -0,0 +1,1016 @@
+package soap_test
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/sait/soapc"
+)
+
+type forwardHeader struct {
+	XMLName       xml.Name `xml:"urn:example myResponseHeader"`
+	TransactionID string   `xml:"transactionId"`
+}
+
+type forwardBody struct {
+	XMLName xml.Name `xml:"urn:example echo"`
+	Message string   `xml:"message"`
+}
+
+const forwardEnvelope = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"
+    xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">
+  <soap:Header>
+    <wsse:Security soap:mustUnderstand="1" soap:actor="urn:upstream">
+      <wsse:UsernameToken><wsse:Username>moga</wsse:Username></wsse:UsernameToken>
+    </wsse:Security>
+    <ex:myResponseHeader xmlns:ex="urn:example"><transactionId>100</transactionId></ex:myResponseHeader>
+    <To xmlns="http://www.w3.org/2005/08/addressing">urn:service</To>
+  </soap:Header>
+  <soap:Body>
+    <echo xmlns="urn:example"><message>hello</message></echo>
+  </soap:Body>
+</soap:Envelope>`
+
+func TestHeaderPreservesUnknownBlocks(t *testing.T) {
+	var (
+		header forwardHeader
+		body   forwardBody
+	)
+	env := Envelope{
+		Header: &Header{Content: &header},
+		Body:   Body{Content: &body},
+	}
+	if err := xml.Unmarshal([]byte(forwardEnvelope), &env); err != nil {
+		t.Fatal(err)
+	}
+	if header.TransactionID != "100" {
+		t.Errorf("want transactionId 100, got %q", header.TransactionID)
+	}
+	if len(env.Header.Unknown) != 2 {
+		t.Fatalf("want 2 unknown blocks, got %d", len(env.Header.Unknown))
+	}
+	if name := env.Header.Unknown[0].XMLName.Local; name != "Security" {
+		t.Errorf("want Security, got %s", name)
+	}
+
+	forwarded := Envelope{
+		Header: &Header{Unknown: env.Header.Unknown},
+		Body:   Body{Content: body},
+	}
+	b, err := xml.Marshal(forwarded)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sec struct {
+		MustUnderstand string `xml:"http://schemas.xmlsoap.org/soap/envelope/ mustUnderstand,attr"`
+		Actor          string `xml:"http://schemas.xmlsoap.org/soap/envelope/ actor,attr"`
+		Username       string `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd UsernameToken>Username"`
+	}
+	var echo forwardBody
+	again := Envelope{
+		Header: &Header{Content: &sec},
+		Body:   Body{Content: &echo},
+	}
+	if err := xml.Unmarshal(b, &again); err != nil {
+		t.Fatal(err)
+	}
+	if sec.MustUnderstand != "1" || sec.Actor != "urn:upstream" || sec.Username != "moga" {
+		t.Errorf("security block not preserved: %+v\n%s", sec, b)
+	}
+	if !strings.Contains(string(b), `<To xmlns="http://www.w3.org/2005/08/addressing">urn:service</To>`) {
+		t.Errorf("addressing block not preserved:\n%s", b)
+	}
+	if echo.Message != "hello" {
+		t.Errorf("want hello, got %q", echo.Message)
+	}
+}
+
+func TestHeaderMaxBlocks(t *testing.T) {
+	envelope := func(n int) string {
+		return `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Header>` +
+			strings.Repeat("<x:noise xmlns:x=\"urn:noise\"/>", n) + `</soap:Header><soap:Body><person/></soap:Body></soap:Envelope>`
+	}
+	var p person
+	if err := DecodeResponse(strings.NewReader(envelope(DefaultMaxHeaderBlocks)), &struct{}{}, &p); err != nil {
+		t.Fatal(err)
+	}
+	if err := DecodeResponse(strings.NewReader(envelope(DefaultMaxHeaderBlocks+1)), &struct{}{}, &p); !errors.Is(err, ErrTooManyHeaderBlocks) {
+		t.Errorf("want ErrTooManyHeaderBlocks, got %v", err)
+	}
+
+	env := Envelope{Header: &Header{MaxBlocks: 3}, Body: Body{Content: &p}}
+	if err := xml.Unmarshal([]byte(envelope(4)), &env); err != ErrTooManyHeaderBlocks {
+		t.Errorf("want ErrTooManyHeaderBlocks over MaxBlocks, got %v", err)
+	}
+}
+
+func TestRawHeaderBytes(t *testing.T) {
+	signed := `<wsse:Security xmlns:wsse="urn:wsse" xmlns:ds="urn:ds"><ds:Signature Id='s1'>c2lnbmVk</ds:Signature></wsse:Security>`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(w, r.Body)
+	}))
+	defer ts.Close()
+
+	res, err := NewClient(ts.URL, false, RawXML(signed)).CallFull("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, err := res.HeaderBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(header) != signed {
+		t.Errorf("want header sent and read verbatim, got %s", header)
+	}
+
+	if header, err = HeaderBytes([]byte(personEnvelope)); err != nil || header != nil {
+		t.Errorf("want no header, got %q, %v", header, err)
+	}
+}
+
+func TestElementOverridesBodyWrapper(t *testing.T) {
+	cases := []struct {
+		name     xml.Name
+		content  interface{}
+		expected string
+	}{
+		{
+			name:     xml.Name{Space: "urn:ops", Local: "DoThing"},
+			content:  testRequest{Message: "test"},
+			expected: `<DoThing xmlns="urn:ops"><message>test</message></DoThing>`,
+		},
+		{
+			name:     xml.Name{Space: "urn:test"},
+			content:  &forwardBody{Message: "test"},
+			expected: `<echo xmlns="urn:test"><message>test</message></echo>`,
+		},
+		{
+			name:     xml.Name{Local: "echoRequest"},
+			content:  forwardBody{Message: "test"},
+			expected: `<echoRequest xmlns="urn:example"><message>test</message></echoRequest>`,
+		},
+	}
+	for _, c := range cases {
+		env := Envelope{Body: Body{Content: Element{Name: c.name, Content: c.content}}}
+		b, err := xml.Marshal(env)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(b), c.expected) {
+			t.Errorf("want %s in\n%s", c.expected, b)
+		}
+	}
+}
+
+func TestFaultCodeName(t *testing.T) {
+	cases := []struct {
+		envelope string
+		expected xml.Name
+	}{
+		{
+			envelope: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:ns2="urn:errors:server">
+  <soap:Body><soap:Fault><faultcode>ns2:ServerError</faultcode><faultstring>boom</faultstring></soap:Fault></soap:Body>
+</soap:Envelope>`,
+			expected: xml.Name{Space: "urn:errors:server", Local: "ServerError"},
+		},
+		{
+			envelope: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:ns2="urn:errors:server">
+  <soap:Body xmlns:ns2="urn:errors:client"><soap:Fault><faultcode>ns2:ServerError</faultcode></soap:Fault></soap:Body>
+</soap:Envelope>`,
+			expected: xml.Name{Space: "urn:errors:client", Local: "ServerError"},
+		},
+		{
+			envelope: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body><soap:Fault><faultcode xmlns:ns0="urn:errors:auth"> ns0:Denied </faultcode></soap:Fault></soap:Body>
+</soap:Envelope>`,
+			expected: xml.Name{Space: "urn:errors:auth", Local: "Denied"},
+		},
+		{
+			envelope: `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body><soap:Fault><faultcode>soap:Server</faultcode></soap:Fault></soap:Body>
+</soap:Envelope>`,
+			expected: xml.Name{Space: "http://schemas.xmlsoap.org/soap/envelope/", Local: "Server"},
+		},
+	}
+	for _, c := range cases {
+		env := Envelope{Body: Body{Content: &struct{}{}}}
+		if err := xml.Unmarshal([]byte(c.envelope), &env); err != nil {
+			t.Fatal(err)
+		}
+		if env.Body.Fault == nil {
+			t.Fatalf("want fault in %s", c.envelope)
+		}
+		if env.Body.Fault.CodeName != c.expected {
+			t.Errorf("want %v, got %v", c.expected, env.Body.Fault.CodeName)
+		}
+	}
+}
+
+func TestTolerantFaultDetection(t *testing.T) {
+	variants := []string{
+		`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<soap:fault><faultstring>lowercase</faultstring></soap:fault></soap:Body></soap:Envelope>`,
+		`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<env:Fault xmlns:env="http://www.w3.org/2003/05/soap-envelope"><faultstring>1.2 namespace</faultstring></env:Fault>` +
+			`</soap:Body></soap:Envelope>`,
+		`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<env:Fault xmlns:env="http://schemas.xmlsoap.org/soap/envelope"><faultstring>no trailing slash</faultstring></env:Fault>` +
+			`</soap:Body></soap:Envelope>`,
+		`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<Fault><faultstring>unqualified</faultstring></Fault></soap:Body></soap:Envelope>`,
+	}
+	for _, v := range variants {
+		var content struct {
+			FaultString string `xml:"faultstring"`
+		}
+		env := Envelope{Body: Body{Content: &content}}
+		if err := xml.Unmarshal([]byte(v), &env); err != nil {
+			t.Fatal(err)
+		}
+		if env.Body.Fault != nil {
+			t.Errorf("strict: want no fault, got %+v", env.Body.Fault)
+		}
+
+		env = Envelope{Body: Body{Content: &content, FaultDetection: FaultDetectTolerant}}
+		if err := xml.Unmarshal([]byte(v), &env); err != nil {
+			t.Fatal(err)
+		}
+		if env.Body.Fault == nil || env.Body.Fault.String == "" {
+			t.Errorf("tolerant: want fault in %s", v)
+		}
+	}
+
+	other := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<ns:Fault xmlns:ns="urn:app"><reason>business object named Fault</reason></ns:Fault></soap:Body></soap:Envelope>`
+	env := Envelope{Body: Body{Content: &struct{}{}, FaultDetection: FaultDetectTolerant}}
+	if err := xml.Unmarshal([]byte(other), &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.Body.Fault != nil {
+		t.Errorf("tolerant: want application element not taken as fault, got %+v", env.Body.Fault)
+	}
+}
+
+const mixedEnvelope = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <getNoticeResponse xmlns="urn:example">
+      <title>Outage</title>
+      <html>Service <b>degraded</b> until <i>18:00</i> &amp; then<br/> <a href="https://status.example.com?a=1&amp;b=2">restored</a>.</html>
+    </getNoticeResponse>
+  </soap:Body>
+</soap:Envelope>`
+
+type mixedHTML struct {
+	Inner string `xml:",innerxml"`
+}
+
+type mixedResponse struct {
+	XMLName xml.Name  `xml:"urn:example getNoticeResponse"`
+	Title   string    `xml:"title"`
+	HTML    mixedHTML `xml:"html"`
+}
+
+func TestBodyMixedContentInnerXML(t *testing.T) {
+	const inner = `Service <b>degraded</b> until <i>18:00</i> &amp; then<br/> <a href="https://status.example.com?a=1&amp;b=2">restored</a>.`
+
+	var res mixedResponse
+	env := Envelope{Body: Body{Content: &res}}
+	if err := xml.Unmarshal([]byte(mixedEnvelope), &env); err != nil {
+		t.Fatal(err)
+	}
+	if res.Title != "Outage" {
+		t.Errorf("want Outage, got %q", res.Title)
+	}
+	if res.HTML.Inner != inner {
+		t.Errorf("want inner XML\n%s\ngot\n%s", inner, res.HTML.Inner)
+	}
+
+	b, err := xml.Marshal(Envelope{Body: Body{Content: res}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again mixedResponse
+	env = Envelope{Body: Body{Content: &again}}
+	if err := xml.Unmarshal(b, &env); err != nil {
+		t.Fatal(err)
+	}
+	if again.HTML.Inner != inner {
+		t.Errorf("round trip: want inner XML\n%s\ngot\n%s", inner, again.HTML.Inner)
+	}
+}
+
+func TestDecodeResponse(t *testing.T) {
+	var (
+		header forwardHeader
+		body   forwardBody
+	)
+	if err := DecodeResponse(strings.NewReader(forwardEnvelope), &header, &body); err != nil {
+		t.Fatal(err)
+	}
+	if header.TransactionID != "100" || body.Message != "hello" {
+		t.Errorf("unexpected header %+v and body %+v", header, body)
+	}
+
+	err := DecodeResponse(strings.NewReader(faultEnvelope), nil, &body)
+	fault, ok := err.(*Fault)
+	if !ok || fault.String != "Something went wrong" {
+		t.Errorf("want fault, got %v", err)
+	}
+
+	if err := DecodeResponse(strings.NewReader("<notSOAP/>"), nil, nil); err == nil {
+		t.Error("want error decoding a non-SOAP document")
+	}
+}
+
+const forwardEnvelope12 = `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">
+  <env:Header>
+    <ex:myResponseHeader xmlns:ex="urn:example" env:mustUnderstand="true"><transactionId>100</transactionId></ex:myResponseHeader>
+  </env:Header>
+  <env:Body>
+    <echo xmlns="urn:example"><message>hello</message></echo>
+  </env:Body>
+</env:Envelope>`
+
+func TestDecodeResponse12(t *testing.T) {
+	var (
+		header forwardHeader
+		body   forwardBody
+	)
+	if err := DecodeResponse(strings.NewReader(forwardEnvelope12), &header, &body); err != nil {
+		t.Fatal(err)
+	}
+	if header.TransactionID != "100" || body.Message != "hello" {
+		t.Errorf("unexpected header %+v and body %+v", header, body)
+	}
+	var env Envelope
+	env.Body.Content = &body
+	if err := xml.Unmarshal([]byte(forwardEnvelope12), &env); err != nil || env.Version != SOAP12 {
+		t.Errorf("want SOAP 1.2 envelope, got %v: %v", env.Version, err)
+	}
+
+	fault11 := `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body>` +
+		`<soap:Fault xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><faultstring>1.1 fault</faultstring></soap:Fault>` +
+		`</env:Body></env:Envelope>`
+	if _, ok := DecodeResponse(strings.NewReader(fault11), nil, nil).(*Fault); ok {
+		t.Error("want a 1.1 fault in a 1.2 envelope not taken as a fault in strict mode")
+	}
+	mixed := `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope">` +
+		`<soap:Body xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><echo xmlns="urn:example"><message>1.1</message></echo></soap:Body></env:Envelope>`
+	body = forwardBody{}
+	if err := DecodeResponse(strings.NewReader(mixed), nil, &body); err != nil || body.Message != "" {
+		t.Errorf("want a body of another SOAP version skipped, got %+v: %v", body, err)
+	}
+	other := `<Envelope xmlns="urn:not-soap"><Body/></Envelope>`
+	if err := DecodeResponse(strings.NewReader(other), nil, nil); err == nil || !strings.Contains(err.Error(), "urn:not-soap") {
+		t.Errorf("want the unknown namespace reported, got %v", err)
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/fault" {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body>` + fault12 + `</env:Body></env:Envelope>`))
+			return
+		}
+		w.Write([]byte(forwardEnvelope12))
+	}))
+	defer ts.Close()
+
+	body = forwardBody{}
+	if err := NewClient(ts.URL, false, nil).CallInto(context.Background(), "", testRequest{Message: "test"}, nil, &body); err != nil || body.Message != "hello" {
+		t.Errorf("want 1.2 response decoded, got %+v: %v", body, err)
+	}
+	_, err := NewClient(ts.URL+"/fault", false, nil).Call("", testRequest{Message: "test"})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Fault == nil || httpErr.Fault.Version != SOAP12 {
+		t.Errorf("want 1.2 fault carried by the HTTP error, got %v", err)
+	}
+}
+
+const fault12 = `<env:Fault xmlns:env="http://www.w3.org/2003/05/soap-envelope" xmlns:m="urn:errors">
+  <env:Code>
+    <env:Value>env:Sender</env:Value>
+    <env:Subcode><env:Value>m:MessageTimeout</env:Value></env:Subcode>
+  </env:Code>
+  <env:Reason>
+    <env:Text xml:lang="en-US">Sender Timeout</env:Text>
+    <env:Text xml:lang="es">Tiempo de espera agotado</env:Text>
+    <env:Text xml:lang="fr-CA">Délai dépassé</env:Text>
+  </env:Reason>
+  <env:Node>urn:gateway</env:Node>
+  <env:Detail>timeout after 30s</env:Detail>
+</env:Fault>`
+
+func TestBodyNilContent(t *testing.T) {
+	data := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` +
+		`<soap:Body><ex:echo xmlns:ex="urn:example" xsi:nil="true"/></soap:Body></soap:Envelope>`
+	var body forwardBody
+	env := Envelope{Body: Body{Content: &body}}
+	if err := xml.Unmarshal([]byte(data), &env); err != nil {
+		t.Fatal(err)
+	}
+	if !env.Body.Nil {
+		t.Error("want xsi:nil content reported")
+	}
+	if err := DecodeResponse(strings.NewReader(data), nil, &body); err != ErrNilContent {
+		t.Errorf("want ErrNilContent, got %v", err)
+	}
+
+	empty := strings.Replace(data, ` xsi:nil="true"`, "", 1)
+	env = Envelope{Body: Body{Content: &body}}
+	if err := xml.Unmarshal([]byte(empty), &env); err != nil || env.Body.Nil {
+		t.Errorf("want empty content not reported nil, got %v", err)
+	}
+	if err := DecodeResponse(strings.NewReader(empty), nil, &body); err != nil {
+		t.Errorf("want empty content decoded, got %v", err)
+	}
+}
+
+func TestFault12Reason(t *testing.T) {
+	var fault Fault
+	if err := xml.Unmarshal([]byte(fault12), &fault); err != nil {
+		t.Fatal(err)
+	}
+	if fault.CodeName != (xml.Name{Space: "http://www.w3.org/2003/05/soap-envelope", Local: "Sender"}) {
+		t.Errorf("unexpected code %v", fault.CodeName)
+	}
+	if fault.String != "Sender Timeout" || fault.Actor != "urn:gateway" || fault.Detail != "timeout after 30s" {
+		t.Errorf("unexpected fault %+v", fault)
+	}
+	if len(fault.Reasons) != 3 {
+		t.Fatalf("want 3 reasons, got %d", len(fault.Reasons))
+	}
+	cases := map[string]string{
+		"en-US": "Sender Timeout",
+		"es":    "Tiempo de espera agotado",
+		"ES-MX": "Tiempo de espera agotado",
+		"fr":    "Délai dépassé",
+		"de":    "Sender Timeout",
+		"":      "Sender Timeout",
+	}
+	for lang, want := range cases {
+		if got := fault.Reason(lang); got != want {
+			t.Errorf("Reason(%q): want %q, got %q", lang, want, got)
+		}
+	}
+
+	legacy := Fault{String: "boom"}
+	if got := legacy.Reason("en"); got != "boom" {
+		t.Errorf("want faultstring for a 1.1 fault, got %q", got)
+	}
+}
+
+func TestFault12Response(t *testing.T) {
+	envelope := `<env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body>` + fault12 + `</env:Body></env:Envelope>`
+	check := func(how string, fault *Fault) {
+		if fault == nil {
+			t.Errorf("%s: want fault", how)
+			return
+		}
+		if fault.Version != SOAP12 || fault.CodeName.Local != "Sender" || fault.Actor != "urn:gateway" {
+			t.Errorf("%s: unexpected fault %+v", how, fault)
+		}
+		if got := fault.Reason("es"); got != "Tiempo de espera agotado" {
+			t.Errorf("%s: want Spanish reason, got %q", how, got)
+		}
+	}
+
+	fault, _ := DecodeResponse(strings.NewReader(envelope), nil, nil).(*Fault)
+	check("DecodeResponse", fault)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(envelope))
+	}))
+	defer ts.Close()
+	_, err := NewClient(ts.URL, false, nil).Call("", testRequest{Message: "test"})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("want *HTTPError, got %v", err)
+	}
+	check("HTTPError", httpErr.Fault)
+}
+
+const detailFaultEnvelope = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:err="urn:partner:errors">
+  <soap:Body>
+    <soap:Fault>
+      <faultcode>soap:Server</faultcode>
+      <faultstring>Order rejected</faultstring>
+      <detail>
+        <err:ErrorInfo>
+          <err:Code>4711</err:Code>
+          <err:Message>credit limit exceeded</err:Message>
+          <err:Field xmlns:f="urn:partner:fields">f:amount</err:Field>
+        </err:ErrorInfo>
+      </detail>
+    </soap:Fault>
+  </soap:Body>
+</soap:Envelope>`
+
+type errorInfo struct {
+	XMLName xml.Name `xml:"urn:partner:errors ErrorInfo"`
+	Code    int      `xml:"urn:partner:errors Code"`
+	Message string   `xml:"urn:partner:errors Message"`
+	Field   string   `xml:"urn:partner:errors Field"`
+}
+
+var faultWithContentEnvelopes = map[string]string{
+	"fault then content": `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<soap:Fault><faultcode>soap:Server</faultcode><faultstring>failed</faultstring></soap:Fault>` +
+		`<person><name><first>Moga</first></name></person></soap:Body></soap:Envelope>`,
+	"content then fault": `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<person><name><first>Moga</first></name></person>` +
+		`<soap:Fault><faultcode>soap:Server</faultcode><faultstring>failed</faultstring></soap:Fault></soap:Body></soap:Envelope>`,
+}
+
+func TestBodyFaultWithContent(t *testing.T) {
+	for name, envelope := range faultWithContentEnvelopes {
+		var p person
+		err := DecodeResponse(strings.NewReader(envelope), nil, &p)
+		var fault *Fault
+		if !errors.As(err, &fault) || fault.String != "failed" {
+			t.Errorf("%s: want fault, got %v", name, err)
+		}
+
+		env := Envelope{Body: Body{Content: &person{}, CaptureUnknown: true}}
+		if err := xml.Unmarshal([]byte(envelope), &env); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if env.Body.Fault == nil || env.Body.Content != nil {
+			t.Errorf("%s: want fault only, got %+v", name, env.Body)
+		}
+		if name == "fault then content" && (len(env.Body.Unknown) != 1 || env.Body.Unknown[0].XMLName.Local != "person") {
+			t.Errorf("%s: want content captured, got %+v", name, env.Body.Unknown)
+		}
+	}
+}
+
+func TestBodyOptionalPointers(t *testing.T) {
+	type profile struct {
+		XMLName xml.Name `xml:"urn:example profile"`
+		Name    *string  `xml:"name"`
+		Age     *int     `xml:"age"`
+		Active  *bool    `xml:"active"`
+	}
+	for _, tc := range []struct {
+		name, fields string
+		present      bool
+	}{
+		{"present empty", `<name></name><age></age><active/>`, true},
+		{"absent", ``, false},
+	} {
+		var p profile
+		envelope := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<p:profile xmlns:p="urn:example">` + tc.fields + `</p:profile></soap:Body></soap:Envelope>`
+		if err := DecodeResponse(strings.NewReader(envelope), nil, &p); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if (p.Name != nil) != tc.present || (p.Age != nil) != tc.present || (p.Active != nil) != tc.present {
+			t.Errorf("%s: want fields present %v, got %+v", tc.name, tc.present, p)
+			continue
+		}
+		if tc.present && (*p.Name != "" || *p.Age != 0 || *p.Active) {
+			t.Errorf("%s: want zero values, got %q %d %v", tc.name, *p.Name, *p.Age, *p.Active)
+		}
+	}
+}
+
+func TestFaultError(t *testing.T) {
+	for _, tc := range []struct {
+		fault Fault
+		want  string
+	}{
+		{Fault{Code: "soap:Client", String: "Invalid request", Detail: "x"}, "Invalid request"},
+		{Fault{Code: "soap:Client", Detail: "\n  account\n  locked\n"}, "SOAP fault soap:Client: account locked"},
+		{Fault{Code: "soap:Server"}, "SOAP fault soap:Server"},
+		{Fault{Detail: "timeout"}, "SOAP fault: timeout"},
+		{Fault{}, "SOAP fault"},
+	} {
+		if got := tc.fault.Error(); got != tc.want {
+			t.Errorf("%+v: want %q, got %q", tc.fault, tc.want, got)
+		}
+	}
+}
+
+func TestFaultDecodeDetail(t *testing.T) {
+	env := Envelope{Body: Body{Content: &struct{}{}}}
+	if err := xml.Unmarshal([]byte(detailFaultEnvelope), &env); err != nil {
+		t.Fatal(err)
+	}
+	fault := env.Body.Fault
+	if fault == nil {
+		t.Fatal("want fault")
+	}
+	var info errorInfo
+	if err := fault.DecodeDetail(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Code != 4711 || info.Message != "credit limit exceeded" || info.Field != "f:amount" {
+		t.Errorf("unexpected detail %+v", info)
+	}
+
+	var other struct {
+		XMLName xml.Name `xml:"urn:other ErrorInfo"`
+	}
+	if err := fault.DecodeDetail(&other); err == nil {
+		t.Error("want namespace mismatch reported")
+	}
+	if err := (&Fault{String: "no detail"}).DecodeDetail(&info); err == nil {
+		t.Error("want error without detail")
+	}
+}
+
+func TestFaultDecodeEscapedDetail(t *testing.T) {
+	const escaped = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault>
+<faultcode>soap:Client</faultcode><faultstring>&lt;Message&gt;invalid&lt;/Message&gt;</faultstring>
+<detail>&amp;lt;e:ErrorInfo xmlns:e=&amp;quot;urn:partner:errors&amp;quot;&amp;gt;&amp;lt;e:Code&amp;gt;4711&amp;lt;/e:Code&amp;gt;&amp;lt;/e:ErrorInfo&amp;gt;</detail>
+</soap:Fault></soap:Body></soap:Envelope>`
+	env := Envelope{Body: Body{Content: &struct{}{}}}
+	if err := xml.Unmarshal([]byte(escaped), &env); err != nil {
+		t.Fatal(err)
+	}
+	fault := env.Body.Fault
+	if fault == nil {
+		t.Fatal("want fault")
+	}
+	var info errorInfo
+	if err := fault.DecodeEscapedDetail(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Code != 4711 {
+		t.Errorf("unexpected detail %+v", info)
+	}
+	var message struct {
+		Text string `xml:",chardata"`
+	}
+	if err := DecodeEscaped(fault.String, &message); err != nil || message.Text != "invalid" {
+		t.Errorf("want faultstring decoded, got %q, %v", message.Text, err)
+	}
+	if err := DecodeEscaped("plain text", &message); err == nil {
+		t.Error("want error without markup")
+	}
+}
+
+var prefixEnvelopes = map[string]string{
+	"soap prefix": `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Header><ex:myResponseHeader xmlns:ex="urn:example"><transactionId>100</transactionId></ex:myResponseHeader></soap:Header>
+  <soap:Body><ex:echo xmlns:ex="urn:example"><message>hello</message></ex:echo></soap:Body>
+</soap:Envelope>`,
+	"default namespace": `<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/">
+  <Header><myResponseHeader xmlns="urn:example"><transactionId xmlns="">100</transactionId></myResponseHeader></Header>
+  <Body><echo xmlns="urn:example"><message xmlns="">hello</message></echo></Body>
+</Envelope>`,
+	"prefix per element": `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <SOAP-ENV:Header xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/"><ex:myResponseHeader xmlns:ex="urn:example"><transactionId>100</transactionId></ex:myResponseHeader></SOAP-ENV:Header>
+  <env:Body xmlns:env="http://schemas.xmlsoap.org/soap/envelope/"><echo xmlns="urn:example"><message xmlns="">hello</message></echo></env:Body>
+</s:Envelope>`,
+	"redundant declarations": `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:ex="urn:example" xmlns:soapenv="http://schemas.xmlsoap.org/soap/envelope/">
+  <soapenv:Header xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><ex:myResponseHeader><transactionId>100</transactionId></ex:myResponseHeader></soapenv:Header>
+  <soap:Body xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:ex="urn:example"><ex:echo><message>hello</message></ex:echo></soap:Body>
+</soap:Envelope>`,
+	"prefix rebound in content": `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/">
+  <s:Header><s:myResponseHeader xmlns:s="urn:example"><transactionId>100</transactionId></s:myResponseHeader></s:Header>
+  <s:Body><s:echo xmlns:s="urn:example"><message>hello</message></s:echo></s:Body>
+</s:Envelope>`,
+	"body default namespace": `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Header xmlns="urn:example"><myResponseHeader><transactionId xmlns="">100</transactionId></myResponseHeader></soap:Header>
+  <soap:Body xmlns="urn:example"><echo><message xmlns="">hello</message></echo></soap:Body>
+</soap:Envelope>`,
+	"inherited default namespace": `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Header><myResponseHeader xmlns="urn:example"><transactionId>100</transactionId></myResponseHeader></soap:Header>
+  <soap:Body><echo xmlns="urn:example"><message>hello</message></echo></soap:Body>
+</soap:Envelope>`,
+}
+
+func TestEnvelopePrefixArrangements(t *testing.T) {
+	for name, data := range prefixEnvelopes {
+		var (
+			header forwardHeader
+			body   forwardBody
+		)
+		env := Envelope{
+			Header: &Header{Content: &header},
+			Body:   Body{Content: &body},
+		}
+		if err := xml.Unmarshal([]byte(data), &env); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if header.TransactionID != "100" || body.Message != "hello" {
+			t.Errorf("%s: unexpected header %+v and body %+v", name, header, body)
+		}
+		if len(env.Header.Unknown) != 0 {
+			t.Errorf("%s: want no unknown header blocks, got %d", name, len(env.Header.Unknown))
+		}
+		if err := DecodeResponse(strings.NewReader(data), &header, &body); err != nil {
+			t.Errorf("%s: DecodeResponse: %v", name, err)
+		}
+	}
+}
+
+func TestBodySliceDocumentOrder(t *testing.T) {
+	data := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body xmlns:l="urn:ledger">` +
+		`<l:record><seq>0</seq></l:record>` +
+		`<x:record xmlns:x="urn:ledger"><seq>1</seq></x:record>` +
+		`<record xmlns="urn:ledger"><seq>2</seq></record>` +
+		`<l:record><seq>3</seq></l:record>` +
+		`</soap:Body></soap:Envelope>`
+	var records []record
+	if err := DecodeResponse(strings.NewReader(data), nil, &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("want 4 records, got %d", len(records))
+	}
+	for i, r := range records {
+		if r.Seq != i {
+			t.Errorf("want seq %d at %d, got %d", i, i, r.Seq)
+		}
+	}
+
+	var pointers []*record
+	if err := DecodeResponse(strings.NewReader(data), nil, &pointers); err != nil {
+		t.Fatal(err)
+	}
+	if len(pointers) != 4 || pointers[3].Seq != 3 {
+		t.Errorf("unexpected records %v", pointers)
+	}
+}
+
+func TestFaultPrefixArrangements(t *testing.T) {
+	faults := []string{
+		`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+			`<SOAP-ENV:Fault xmlns:SOAP-ENV="http://schemas.xmlsoap.org/soap/envelope/"><faultcode>SOAP-ENV:Client</faultcode></SOAP-ENV:Fault>` +
+			`</soap:Body></soap:Envelope>`,
+		`<Envelope xmlns="http://schemas.xmlsoap.org/soap/envelope/"><Body>` +
+			`<Fault><faultcode xmlns="">Client</faultcode></Fault></Body></Envelope>`,
+		`<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><env:Body xmlns:env="http://schemas.xmlsoap.org/soap/envelope/">` +
+			`<s:Fault><faultcode>env:Client</faultcode></s:Fault></env:Body></s:Envelope>`,
+	}
+	for _, data := range faults {
+		env := Envelope{Body: Body{Content: &struct{}{}}}
+		if err := xml.Unmarshal([]byte(data), &env); err != nil {
+			t.Errorf("%v in %s", err, data)
+			continue
+		}
+		if env.Body.Fault == nil || env.Body.Fault.CodeName.Local != "Client" {
+			t.Errorf("want Client fault in %s, got %+v", data, env.Body.Fault)
+		}
+	}
+
+	rebound := `<s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/"><s:Body>` +
+		`<s:Fault xmlns:s="urn:example"><reason>application element</reason></s:Fault></s:Body></s:Envelope>`
+	env := Envelope{Body: Body{Content: &struct{}{}}}
+	if err := xml.Unmarshal([]byte(rebound), &env); err != nil {
+		t.Fatal(err)
+	}
+	if env.Body.Fault != nil {
+		t.Errorf("want a Fault outside the envelope namespace not taken as fault, got %+v", env.Body.Fault)
+	}
+}
+
+func TestStreamPrefixArrangements(t *testing.T) {
+	for name, data := range prefixEnvelopes {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(data))
+		}))
+		var messages []string
+		err := NewClient(ts.URL, false, nil).CallStream("", testRequest{Message: "test"}, func(d *xml.Decoder, start xml.StartElement) error {
+			var body forwardBody
+			if err := d.DecodeElement(&body, &start); err != nil {
+				return err
+			}
+			messages = append(messages, body.Message)
+			return nil
+		})
+		ts.Close()
+		if err != nil || len(messages) != 1 || messages[0] != "hello" {
+			t.Errorf("%s: want hello streamed, got %v, %v", name, messages, err)
+		}
+	}
+}
+
+func TestBodyCaptureUnknown(t *testing.T) {
+	data := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<ex:notice xmlns:ex="urn:example">maintenance tonight</ex:notice>` +
+		`<echo xmlns="urn:example"><message>hello</message></echo>` +
+		`<ex:trace xmlns:ex="urn:example" id="42"><hop>gateway</hop></ex:trace>` +
+		`</soap:Body></soap:Envelope>`
+
+	var body forwardBody
+	env := Envelope{Body: Body{Content: &body}}
+	if err := xml.Unmarshal([]byte(data), &env); err == nil {
+		t.Error("want multiple elements error by default")
+	}
+
+	body = forwardBody{}
+	env = Envelope{Body: Body{Content: &body, CaptureUnknown: true}}
+	if err := xml.Unmarshal([]byte(data), &env); err != nil {
+		t.Fatal(err)
+	}
+	if body.Message != "hello" {
+		t.Errorf("want hello, got %q", body.Message)
+	}
+	if len(env.Body.Unknown) != 2 || env.Body.Unknown[0].XMLName.Local != "notice" || env.Body.Unknown[1].XMLName.Local != "trace" {
+		t.Fatalf("want notice and trace captured, got %+v", env.Body.Unknown)
+	}
+
+	b, err := xml.Marshal(env.Body.Unknown[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var trace struct {
+		XMLName xml.Name `xml:"urn:example trace"`
+		ID      string   `xml:"id,attr"`
+		Hop     string   `xml:"hop"`
+	}
+	if err := xml.Unmarshal(b, &trace); err != nil {
+		t.Fatal(err)
+	}
+	if trace.ID != "42" || trace.Hop != "gateway" {
+		t.Errorf("unexpected captured element %+v from %s", trace, b)
+	}
+}
+
+func TestInNamespacePerCall(t *testing.T) {
+	var received []xml.Name
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			XMLName xml.Name
+			Message string `xml:"message"`
+		}
+		env := Envelope{Body: Body{Content: &body}}
+		if err := xml.NewDecoder(r.Body).Decode(&env); err != nil || body.Message != "hello" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, body.XMLName)
+		w.Write([]byte(personEnvelope))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, false, nil)
+	req := &forwardBody{Message: "hello"}
+	for _, ns := range []string{"urn:test", "urn:prod"} {
+		if _, err := client.Call("", InNamespace(ns, req)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := client.Call("", req); err != nil {
+		t.Fatal(err)
+	}
+	want := []xml.Name{{Space: "urn:test", Local: "echo"}, {Space: "urn:prod", Local: "echo"}, {Space: "urn:example", Local: "echo"}}
+	if len(received) != len(want) {
+		t.Fatalf("want %v, got %v", want, received)
+	}
+	for i := range want {
+		if received[i] != want[i] {
+			t.Errorf("call %d: want %v, got %v", i, want[i], received[i])
+		}
+	}
+	if req.XMLName.Space != "" {
+		t.Errorf("want request left untouched, got %v", req.XMLName)
+	}
+}
+
+func TestOperationNamespaces(t *testing.T) {
+	client := NewClient("http://localhost/", false, nil, WithOperationNamespaces(map[string]string{
+		"urn:orders/Echo":    "urn:orders",
+		`"urn:billing/Echo"`: "urn:billing",
+	}))
+	cases := []struct {
+		action  string
+		request interface{}
+		space   string
+	}{
+		{`"urn:orders/Echo"`, forwardBody{Message: "hello"}, "urn:orders"},
+		{"urn:billing/Echo", &forwardBody{Message: "hello"}, "urn:billing"},
+		{"urn:other/Echo", forwardBody{Message: "hello"}, "urn:example"},
+		{"urn:orders/Echo", InNamespace("urn:explicit", forwardBody{Message: "hello"}), "urn:explicit"},
+	}
+	for _, c := range cases {
+		req, err := client.DryRun(c.action, c.request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			XMLName xml.Name
+		}
+		env := Envelope{Body: Body{Content: &body}}
+		if err := xml.NewDecoder(req.Body).Decode(&env); err != nil {
+			t.Fatal(err)
+		}
+		if body.XMLName != (xml.Name{Space: c.space, Local: "echo"}) {
+			t.Errorf("%s: want echo in %s, got %v", c.action, c.space, body.XMLName)
+		}
+	}
+}
+
+func TestEnvelopeVersion(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<?xml version="1.0"?><env:Envelope xmlns:env="http://www.w3.org/2003/05/soap-envelope"><env:Body/></env:Envelope>`))
+	}))
+	defer ts.Close()
+
+	res, err := NewClient(ts.URL, false, nil).CallFull("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := res.Version(); err != nil || v != SOAP12 {
+		t.Errorf("want SOAP 1.2, got %v: %v", v, err)
+	}
+	if v, err := EnvelopeVersion([]byte(personEnvelope)); err != nil || v != SOAP11 {
+		t.Errorf("want SOAP 1.1, got %v: %v", v, err)
+	}
+	if _, err := EnvelopeVersion([]byte(`<Envelope/>`)); err == nil {
+		t.Error("want error for an unqualified envelope")
+	}
+}
+
+func TestFault12Marshal(t *testing.T) {
+	envelope := Envelope{
+		Version: SOAP12,
+		Body: Body{
+			Fault: &Fault{
+				Code:   "soap:Client",
+				String: "Invalid request",
+				Actor:  "urn:gateway",
+				Detail: "missing id",
+			},
+		},
+	}
+	b, err := xml.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope"><Body xmlns="http://www.w3.org/2003/05/soap-envelope">`,
+		`<Value xmlns="http://www.w3.org/2003/05/soap-envelope">env:Sender</Value>`,
+		`xml:lang="en">Invalid request</Text>`,
+		`>urn:gateway</Node>`,
+		`>missing id</Detail>`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("want %s in\n%s", want, b)
+		}
+	}
+
+	var decoded struct {
+		Body struct {
+			Fault *Fault `xml:"http://www.w3.org/2003/05/soap-envelope Fault"`
+		} `xml:"http://www.w3.org/2003/05/soap-envelope Body"`
+	}
+	if err := xml.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("%s\n%s", err, b)
+	}
+	fault := decoded.Body.Fault
+	if fault == nil || fault.Version != SOAP12 || fault.CodeName.Local != "Sender" ||
+		fault.String != "Invalid request" || fault.Actor != "urn:gateway" || fault.Detail != "missing id" {
+		t.Errorf("unexpected fault %+v", fault)
+	}
+
+	b, err = xml.Marshal(Fault{Code: "soap:Server", String: "boom"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<Fault xmlns="http://schemas.xmlsoap.org/soap/envelope/"><faultcode>soap:Server</faultcode><faultstring>boom</faultstring></Fault>`; string(b) != want {
+		t.Errorf("want 1.1 fault by default %s, got %s", want, b)
+	}
+}
+
+func TestEnvelope12RoundTrip(t *testing.T) {
+	envelope := Envelope{
+		Version: SOAP12,
+		Header:  &Header{Content: forwardHeader{TransactionID: "100"}},
+		Body:    Body{Content: forwardBody{Message: "hello"}},
+	}
+	b, err := xml.Marshal(envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		header forwardHeader
+		body   forwardBody
+	)
+	if err := DecodeResponse(strings.NewReader(string(b)), &header, &body); err != nil {
+		t.Fatalf("%s\n%s", err, b)
+	}
+	if header.TransactionID != "100" || body.Message != "hello" {
+		t.Errorf("unexpected header %+v and body %+v in\n%s", header, body, b)
+	}
+
+	envelope = Envelope{Version: SOAP12, Body: Body{Fault: &Fault{Code: "soap:Client", String: "Invalid request"}}}
+	if b, err = xml.Marshal(envelope); err != nil {
+		t.Fatal(err)
+	}
+	fault, ok := DecodeResponse(strings.NewReader(string(b)), nil, nil).(*Fault)
+	if !ok || fault.Version != SOAP12 || fault.CodeName.Local != "Sender" || fault.String != "Invalid request" {
+		t.Errorf("want fault read back, got %+v from\n%s", fault, b)
+	}
+}
@@ -0,0 +1,117 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// HealthStatus health check result
+type HealthStatus int
+
+// HealthStatus values
+const (
+	HealthReachable HealthStatus = iota
+	HealthUnreachable
+	HealthTLSError
+	HealthHTTPError
+	HealthNotSOAP
+)
+
+func (h HealthStatus) String() string {
+	switch h {
+	case HealthReachable:
+		return "reachable"
+	case HealthUnreachable:
+		return "unreachable"
+	case HealthTLSError:
+		return "TLS error"
+	case HealthHTTPError:
+		return "HTTP error"
+	case HealthNotSOAP:
+		return "not SOAP"
+	}
+	return fmt.Sprintf("HealthStatus(%d)", int(h))
+}
+
+// HealthError health check failure
+type HealthError struct {
+	Status     HealthStatus
+	StatusCode int
+	Err        error
+}
+
+func (e *HealthError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("health check: %s: %s", e.Status, e.Err.Error())
+	}
+	return fmt.Sprintf("health check: %s: HTTP Status Code: %d", e.Status, e.StatusCode)
+}
+
+// maxHealthCheckBody upper bound of response bytes inspected by HealthCheck
+const maxHealthCheckBody = 64 * 1024
+
+// HealthCheck verify the endpoint is reachable and speaking SOAP.
+// An empty envelope is POSTed using the same transport as Call; any
+// response carrying a SOAP envelope, including a fault, is considered
+// healthy. Otherwise a *HealthError classifying the failure is returned.
+// The headers of WithHeaders are sent, so an endpoint authenticating them
+// can be probed; the header block of WithTokenProvider is not.
+func (s *Client) HealthCheck(ctx context.Context) error {
+	buffer := new(bytes.Buffer)
+	buffer.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+	if err := xml.NewEncoder(buffer).Encode(Envelope{}); err != nil {
+		return fmt.Errorf("failed to encode envelope: %s", err.Error())
+	}
+	req, err := http.NewRequest("POST", s.url, buffer)
+	if err != nil {
+		return fmt.Errorf("failed to create POST request: %s", err.Error())
+	}
+	req = req.WithContext(ctx)
+	req.Header.Add("Content-Type", "text/xml; charset=\"utf-8\"")
+	req.Header.Set("SOAPAction", "")
+	req.Header.Set("User-Agent", s.userAgent)
+	for key, value := range s.headers {
+		req.Header.Set(key, value)
+	}
+	req.Close = true
+
+	res, err := s.httpClient().Do(req)
+	if err != nil {
+		if transportErrorKind(err) == TransportTLS {
+			return &HealthError{Status: HealthTLSError, Err: err}
+		}
+		return &HealthError{Status: HealthUnreachable, Err: err}
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxHealthCheckBody))
+	if err != nil {
+		return &HealthError{Status: HealthUnreachable, StatusCode: res.StatusCode, Err: err}
+	}
+	if isEnvelope(body) {
+		return nil
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &HealthError{Status: HealthHTTPError, StatusCode: res.StatusCode}
+	}
+	return &HealthError{Status: HealthNotSOAP, StatusCode: res.StatusCode}
+}
+
+// isEnvelope report whether the root element of data is a SOAP Envelope
+func isEnvelope(data []byte) bool {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return false
+		}
+		if se, ok := token.(xml.StartElement); ok {
+			return checkEnvelope(se) == nil
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package soap_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/achiku/testsvr"
+	. "github.com/sait/soapc"
+)
+
+func healthFaultResponse(logger testsvr.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <soap:Fault><faultcode>soap:Client</faultcode><faultstring>no operation</faultstring></soap:Fault>
+  </soap:Body>
+</soap:Envelope>`))
+	}
+}
+
+func healthHTMLResponse(logger testsvr.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body>It works!</body></html>"))
+	}
+}
+
+var healthHandlerMap = map[string]testsvr.CreateHandler{
+	"/fault": healthFaultResponse,
+	"/html":  healthHTMLResponse,
+}
+
+func TestHealthCheck(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(healthHandlerMap, t))
+	defer ts.Close()
+
+	cases := []struct {
+		path   string
+		status HealthStatus
+	}{
+		{path: "/fault", status: HealthReachable},
+		{path: "/html", status: HealthNotSOAP},
+		{path: "/notfound", status: HealthHTTPError},
+	}
+	for _, c := range cases {
+		client := NewClient(ts.URL+c.path, false, nil)
+		err := client.HealthCheck(context.Background())
+		if c.status == HealthReachable {
+			if err != nil {
+				t.Errorf("%s: %s", c.path, err)
+			}
+			continue
+		}
+		var herr *HealthError
+		if !errors.As(err, &herr) {
+			t.Fatalf("%s: want *HealthError, got %v", c.path, err)
+		}
+		if herr.Status != c.status {
+			t.Errorf("%s: want %s, got %s", c.path, c.status, herr.Status)
+		}
+	}
+}
+
+func TestHealthCheckTLSError(t *testing.T) {
+	ts := httptest.NewTLSServer(testsvr.NewMux(healthHandlerMap, t))
+	defer ts.Close()
+
+	client := NewClient(ts.URL+"/fault", false, nil)
+	err := client.HealthCheck(context.Background())
+	var herr *HealthError
+	if !errors.As(err, &herr) || herr.Status != HealthTLSError {
+		t.Fatalf("want TLS error, got %v", err)
+	}
+
+	client = NewClient(ts.URL+"/fault", true, nil)
+	if err := client.HealthCheck(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHealthCheckUnreachable(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(healthHandlerMap, t))
+	url := ts.URL
+	ts.Close()
+
+	client := NewClient(url, false, nil)
+	err := client.HealthCheck(context.Background())
+	var herr *HealthError
+	if !errors.As(err, &herr) || herr.Status != HealthUnreachable {
+		t.Fatalf("want unreachable, got %v", err)
+	}
+}
+
+func TestHealthCheckHeaders(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-API-Key") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		healthFaultResponse(t)(w, r)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, false, nil, WithHeaders(map[string]string{"X-API-Key": "secret"}))
+	if err := client.HealthCheck(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
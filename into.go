@@ -0,0 +1,63 @@
+package soap
+
+import (
+	"context"
+	"fmt"
+)
+
+// Resetter response struct that can be cleared for reuse, e.g. taken from
+// a sync.Pool. Reset should truncate slices to [:0] rather than drop them,
+// so decoding appends into the capacity left by the previous response, and
+// set optional pointer fields to nil, which decoding leaves untouched when
+// their element is absent.
+type Resetter interface {
+	Reset()
+}
+
+// CallInto SOAP client API call decoding the response into respHeader and
+// respBody, as DecodeResponse does, and returning a fault in the body as a
+// *Fault, mapped by the fault mapper if any. A respHeader or respBody
+// implementing Resetter is reset before decoding, so one struct can be
+// recycled across calls instead of allocated per call. Strings decoded
+// into it are immutable and can be kept, but the backing arrays of slices,
+// []byte and RawXML fields included, are reused by the next call decoding
+// into it: copy those before returning the struct to its pool. A response
+// failing to decode is returned in a *DecodeError; xsi:nil content, which
+// decodes fine, as ErrNilContent.
+func (s *Client) CallInto(ctx context.Context, soapAction string, request, respHeader, respBody interface{}) error {
+	res, err := s.call(ctx, soapAction, request)
+	if err != nil {
+		return err
+	}
+	for _, v := range []interface{}{respHeader, respBody} {
+		if r, ok := v.(Resetter); ok {
+			r.Reset()
+		}
+	}
+	err = res.Decode(respHeader, respBody)
+	if fault, ok := err.(*Fault); ok {
+		s.inspectFault(fault)
+		return s.mapFault(fault, fault)
+	}
+	if err != nil && err != ErrNilContent {
+		return &DecodeError{Err: err, Body: res.Body}
+	}
+	return err
+}
+
+// DecodeError response that failed to decode, e.g. after the server
+// changed its schema
+type DecodeError struct {
+	Err error
+	// Body raw response as received
+	Body []byte
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("failed to decode SOAP response: %s", e.Err.Error())
+}
+
+// Unwrap return the decoding error
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
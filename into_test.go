@@ -0,0 +1,113 @@
+package soap_test
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	. "github.com/sait/soapc"
+)
+
+type ledger struct {
+	XMLName xml.Name `xml:"urn:ledger ledger"`
+	Records []int    `xml:"record>seq"`
+}
+
+func (l *ledger) Reset() {
+	l.Records = l.Records[:0]
+}
+
+// ledgerServer respond with as many records as the count query parameter
+func ledgerServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, _ := strconv.Atoi(r.URL.Query().Get("count"))
+		var b strings.Builder
+		b.WriteString(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><l:ledger xmlns:l="urn:ledger">`)
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&b, "<record><seq>%d</seq></record>", i)
+		}
+		b.WriteString(`</l:ledger></soap:Body></soap:Envelope>`)
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(b.String()))
+	}))
+}
+
+func TestCallInto(t *testing.T) {
+	ts := ledgerServer()
+	defer ts.Close()
+
+	var l ledger
+	for _, n := range []int{5, 2} {
+		client := NewClient(ts.URL+"?count="+strconv.Itoa(n), false, nil)
+		if err := client.CallInto(context.Background(), "", testRequest{Message: "test"}, nil, &l); err != nil {
+			t.Fatal(err)
+		}
+		if len(l.Records) != n || l.Records[n-1] != n-1 {
+			t.Errorf("want %d records, got %v", n, l.Records)
+		}
+	}
+
+	fault := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(faultEnvelope))
+	}))
+	defer fault.Close()
+	err := NewClient(fault.URL, false, nil).CallInto(context.Background(), "", testRequest{Message: "test"}, nil, &l)
+	var f *Fault
+	if !errors.As(err, &f) || f.String != "Something went wrong" {
+		t.Errorf("want fault, got %v", err)
+	}
+
+	var wrong struct {
+		XMLName xml.Name `xml:"urn:other ledger"`
+	}
+	err = NewClient(ts.URL+"?count=1", false, nil).CallInto(context.Background(), "", testRequest{Message: "test"}, nil, &wrong)
+	var decodeErr *DecodeError
+	if !errors.As(err, &decodeErr) || !strings.Contains(string(decodeErr.Body), "<seq>0</seq>") {
+		t.Errorf("want decode error with the raw response, got %v", err)
+	}
+
+	nilContent := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/" xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance">` +
+			`<soap:Body><l:ledger xmlns:l="urn:ledger" xsi:nil="true"/></soap:Body></soap:Envelope>`))
+	}))
+	defer nilContent.Close()
+	err = NewClient(nilContent.URL, false, nil).CallInto(context.Background(), "", testRequest{Message: "test"}, nil, &l)
+	if err != ErrNilContent || errors.As(err, &decodeErr) {
+		t.Errorf("want ErrNilContent unwrapped, got %v", err)
+	}
+}
+
+func BenchmarkCallInto(b *testing.B) {
+	ts := ledgerServer()
+	defer ts.Close()
+	client := NewClient(ts.URL+"?count=100", false, nil)
+	ctx := context.Background()
+
+	b.Run("Fresh", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var l ledger
+			if err := client.CallInto(ctx, "", testRequest{Message: "test"}, nil, &l); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("Pooled", func(b *testing.B) {
+		pool := sync.Pool{New: func() interface{} { return new(ledger) }}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			l := pool.Get().(*ledger)
+			if err := client.CallInto(ctx, "", testRequest{Message: "test"}, nil, l); err != nil {
+				b.Fatal(err)
+			}
+			pool.Put(l)
+		}
+	})
+}
@@ -0,0 +1,430 @@
+package soap
+
+import (
+	"encoding"
+	"encoding/xml"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSONTagged encode and decode V, a struct or pointer to one, naming its
+// fields after their json tags so that types defined for a JSON API need
+// no xml tags. Fields with an xml tag follow it instead; of its options,
+// attr, chardata and omitempty are honoured.
+// Fields tagged json:"-" or xml:"-" are skipped, and those of untagged
+// embedded structs promoted as encoding/json does. Nested structs, pointers
+// and slices of them are handled the same way, except values implementing
+// xml.Marshaler or encoding.TextMarshaler, such as DateTime. To decode,
+// pass a *JSONTagged holding a pointer to the struct, e.g. as Body Content.
+type JSONTagged struct {
+	// Name element name; V's XMLName, then its type name, when empty
+	Name xml.Name
+	V    interface{}
+}
+
+type jsonField struct {
+	// index path of the field, through the embedded structs promoting it
+	index     []int
+	name      xml.Name
+	attr      bool
+	chardata  bool
+	omitempty bool
+	// tagged name set by a tag rather than taken from the field
+	tagged bool
+}
+
+// jsonFields return the encodable fields of struct type t. As with
+// encoding/json, the fields of embedded structs without a tag naming them
+// are promoted; of fields sharing a name, the least nested wins, a tie
+// going to the only tagged one, and names still ambiguous are dropped.
+func jsonFields(t reflect.Type) []jsonField {
+	fields := collectJSONFields(t, nil, map[reflect.Type]bool{})
+	kept := fields[:0:0]
+	for i, f := range fields {
+		dominated := false
+		for j, g := range fields {
+			if i == j || g.name != f.name || g.attr != f.attr {
+				continue
+			}
+			if len(g.index) < len(f.index) || len(g.index) == len(f.index) && (g.tagged || !f.tagged) {
+				dominated = true
+				break
+			}
+		}
+		if !dominated {
+			kept = append(kept, f)
+		}
+	}
+	return kept
+}
+
+// collectJSONFields return the fields of struct type t at index, embedded
+// structs flattened; visited guards against embedding cycles
+func collectJSONFields(t reflect.Type, index []int, visited map[reflect.Type]bool) []jsonField {
+	if visited[t] {
+		return nil
+	}
+	visited[t] = true
+	defer delete(visited, t)
+
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Name == "XMLName" {
+			continue
+		}
+		f := jsonField{index: append(index[:len(index):len(index)], i), name: xml.Name{Local: sf.Name}}
+		if tag, ok := sf.Tag.Lookup("xml"); ok {
+			if tag == "-" {
+				continue
+			}
+			parts := strings.Split(tag, ",")
+			if parts[0] != "" {
+				f.tagged = true
+				if j := strings.LastIndex(parts[0], " "); j >= 0 {
+					f.name = xml.Name{Space: parts[0][:j], Local: parts[0][j+1:]}
+				} else {
+					f.name.Local = parts[0]
+				}
+			}
+			for _, opt := range parts[1:] {
+				switch opt {
+				case "attr":
+					f.attr = true
+				case "chardata":
+					f.chardata = true
+				case "omitempty":
+					f.omitempty = true
+				}
+			}
+		} else if tag, ok := sf.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			parts := strings.Split(tag, ",")
+			if parts[0] != "" {
+				f.tagged = true
+				f.name.Local = parts[0]
+			}
+			for _, opt := range parts[1:] {
+				if opt == "omitempty" {
+					f.omitempty = true
+				}
+			}
+		}
+		if sf.Anonymous && !f.tagged {
+			ft := sf.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fields = append(fields, collectJSONFields(ft, f.index, visited)...)
+				continue
+			}
+		}
+		if sf.PkgPath != "" {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+// fieldOf return the field of struct v at index, allocating the nil
+// embedded pointers on the way when alloc is set, or reporting false; as
+// with encoding/json, a nil pointer to an unexported type is not allocated
+func fieldOf(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
+
+// MarshalXML encode V by its json tags
+func (j JSONTagged) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	v := reflect.ValueOf(j.V)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return fmt.Errorf("soap: JSONTagged value must be a struct, not %s", v.Type())
+	}
+	start = xml.StartElement{Name: j.Name}
+	if start.Name.Local == "" {
+		if name, ok := xmlNameOf(j.V); ok {
+			start.Name = name
+		} else {
+			start.Name.Local = v.Type().Name()
+		}
+	}
+
+	fields := jsonFields(v.Type())
+	for _, f := range fields {
+		fv, ok := fieldOf(v, f.index, false)
+		if !ok || !f.attr || (f.omitempty && isEmptyValue(fv)) {
+			continue
+		}
+		text, err := textOf(fv)
+		if err != nil {
+			return err
+		}
+		start.Attr = append(start.Attr, xml.Attr{Name: f.name, Value: text})
+	}
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	for _, f := range fields {
+		fv, ok := fieldOf(v, f.index, false)
+		if !ok || f.attr || (f.omitempty && isEmptyValue(fv)) {
+			continue
+		}
+		if f.chardata {
+			text, err := textOf(fv)
+			if err != nil {
+				return err
+			}
+			if err := e.EncodeToken(xml.CharData(text)); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := encodeJSONValue(e, fv, f.name); err != nil {
+			return err
+		}
+	}
+	return e.EncodeToken(start.End())
+}
+
+var (
+	marshalerType     = reflect.TypeOf((*xml.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	unmarshalerType   = reflect.TypeOf((*xml.Unmarshaler)(nil)).Elem()
+	textUnmarshalType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// customMarshal report whether t encodes itself
+func customMarshal(t reflect.Type) bool {
+	return t.Implements(marshalerType) || t.Implements(textMarshalerType) ||
+		reflect.PtrTo(t).Implements(marshalerType) || reflect.PtrTo(t).Implements(textMarshalerType)
+}
+
+// customUnmarshal report whether *t decodes itself
+func customUnmarshal(t reflect.Type) bool {
+	return reflect.PtrTo(t).Implements(unmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalType)
+}
+
+func encodeJSONValue(e *xml.Encoder, v reflect.Value, name xml.Name) error {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		if customMarshal(v.Type()) {
+			break
+		}
+		v = v.Elem()
+	}
+	start := xml.StartElement{Name: name}
+	switch {
+	case customMarshal(v.Type()):
+	case v.Kind() == reflect.Struct:
+		return e.Encode(JSONTagged{Name: name, V: v.Interface()})
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8, v.Kind() == reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			if err := encodeJSONValue(e, v.Index(i), name); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return e.EncodeElement(v.Interface(), start)
+}
+
+// UnmarshalXML decode into V, a pointer to struct, by its json tags
+func (j JSONTagged) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	v := reflect.ValueOf(j.V)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return xml.UnmarshalError("JSONTagged value must be a pointer to a struct")
+	}
+	v = v.Elem()
+	fields := jsonFields(v.Type())
+
+	for _, attr := range start.Attr {
+		for _, f := range fields {
+			if f.attr && f.name.Local == attr.Name.Local {
+				fv, ok := fieldOf(v, f.index, true)
+				if !ok {
+					continue
+				}
+				if err := setText(fv, attr.Value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	var chardata []byte
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			var (
+				field reflect.Value
+				found bool
+			)
+			for _, f := range fields {
+				if !f.attr && !f.chardata && f.name.Local == t.Name.Local {
+					field, found = fieldOf(v, f.index, true)
+					break
+				}
+			}
+			if !found {
+				err = d.Skip()
+			} else {
+				err = decodeJSONValue(d, t, field)
+			}
+			if err != nil {
+				return err
+			}
+		case xml.CharData:
+			chardata = append(chardata, t...)
+		case xml.EndElement:
+			for _, f := range fields {
+				if !f.chardata {
+					continue
+				}
+				if fv, ok := fieldOf(v, f.index, true); ok {
+					return setText(fv, string(chardata))
+				}
+			}
+			return nil
+		}
+	}
+}
+
+func decodeJSONValue(d *xml.Decoder, start xml.StartElement, v reflect.Value) error {
+	switch {
+	case customUnmarshal(v.Type()):
+	case v.Kind() == reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeJSONValue(d, start, v.Elem())
+	case v.Kind() == reflect.Struct:
+		return d.DecodeElement(&JSONTagged{V: v.Addr().Interface()}, &start)
+	case v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8:
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := decodeJSONValue(d, start, elem); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, elem))
+		return nil
+	}
+	return d.DecodeElement(v.Addr().Interface(), &start)
+}
+
+// textOf return the text form of a basic or TextMarshaler value
+func textOf(v reflect.Value) (string, error) {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, err := m.MarshalText()
+		return string(text), err
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()), nil
+	}
+	return "", fmt.Errorf("soap: cannot encode %s as text", v.Type())
+}
+
+// setText set a basic or TextUnmarshaler value from its text form
+func setText(v reflect.Value, text string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		v = v.Elem()
+	}
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(text))
+	}
+	text = strings.TrimSpace(text)
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(text)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(text, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(text, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	default:
+		return fmt.Errorf("soap: cannot decode text into %s", v.Type())
+	}
+	return nil
+}
+
+// isEmptyValue report whether v is empty in the omitempty sense
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return v.IsNil()
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+package soap_test
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/sait/soapc"
+)
+
+type jsonAddress struct {
+	City string `json:"city"`
+	Zip  string `json:"zip_code"`
+}
+
+type jsonCustomer struct {
+	ID        int           `json:"id"`
+	Kind      string        `xml:"kind,attr"`
+	Name      string        `json:"name"`
+	Email     string        `json:"email,omitempty"`
+	Internal  string        `json:"-"`
+	Notes     string        `json:"notes" xml:"remarks"`
+	Address   *jsonAddress  `json:"address"`
+	Tags      []string      `json:"tags"`
+	Since     DateTime      `json:"since"`
+	Addresses []jsonAddress `json:"addresses"`
+}
+
+func TestJSONTaggedRoundTrip(t *testing.T) {
+	in := jsonCustomer{
+		ID:        7,
+		Kind:      "retail",
+		Name:      "Moga",
+		Internal:  "secret",
+		Notes:     "vip",
+		Address:   &jsonAddress{City: "Hermosillo", Zip: "83000"},
+		Tags:      []string{"a", "b"},
+		Since:     DateTime(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)),
+		Addresses: []jsonAddress{{City: "Obregon"}, {City: "Guaymas"}},
+	}
+	b, err := xml.Marshal(JSONTagged{Name: xml.Name{Space: "urn:crm", Local: "customer"}, V: in})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<customer xmlns="urn:crm" kind="retail">`,
+		`<id>7</id>`,
+		`<remarks>vip</remarks>`,
+		`<address><city>Hermosillo</city><zip_code>83000</zip_code></address>`,
+		`<tags>a</tags><tags>b</tags>`,
+		`<since>2020-01-02T03:04:05Z</since>`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("want %s in\n%s", want, b)
+		}
+	}
+	if strings.Contains(string(b), "email") || strings.Contains(string(b), "secret") {
+		t.Errorf("want omitted fields left out:\n%s", b)
+	}
+
+	var out jsonCustomer
+	if err := xml.Unmarshal(b, &JSONTagged{V: &out}); err != nil {
+		t.Fatal(err)
+	}
+	in.Internal = ""
+	if out.ID != in.ID || out.Kind != in.Kind || out.Name != in.Name || out.Notes != in.Notes ||
+		*out.Address != *in.Address || strings.Join(out.Tags, ",") != "a,b" ||
+		!time.Time(out.Since).Equal(time.Time(in.Since)) || len(out.Addresses) != 2 || out.Addresses[1].City != "Guaymas" {
+		t.Errorf("want %+v, got %+v", in, out)
+	}
+}
+
+func TestJSONTaggedBody(t *testing.T) {
+	var addr jsonAddress
+	env := Envelope{Body: Body{Content: &JSONTagged{V: &addr}}}
+	data := `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body>` +
+		`<address><city>Hermosillo</city><zip_code>83000</zip_code></address></soap:Body></soap:Envelope>`
+	if err := xml.Unmarshal([]byte(data), &env); err != nil {
+		t.Fatal(err)
+	}
+	if addr.City != "Hermosillo" || addr.Zip != "83000" {
+		t.Errorf("want decoded address, got %+v", addr)
+	}
+}
+
+type jsonBase struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type jsonAudit struct {
+	Author string `json:"author"`
+}
+
+type jsonDerived struct {
+	jsonBase
+	*jsonAudit
+	Name  string `json:"display_name"`
+	Owner jsonBase
+	Label string `json:"name"`
+}
+
+func TestJSONTaggedEmbedded(t *testing.T) {
+	in := jsonDerived{
+		jsonBase:  jsonBase{ID: 1, Name: "shadowed"},
+		jsonAudit: &jsonAudit{Author: "moga"},
+		Name:      "n",
+		Label:     "label",
+	}
+	b, err := xml.Marshal(JSONTagged{Name: xml.Name{Local: "d"}, V: in})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<d><id>1</id><author>moga</author><display_name>n</display_name>` +
+		`<Owner><id>0</id><name></name></Owner><name>label</name></d>`; string(b) != want {
+		t.Errorf("want %s, got %s", want, b)
+	}
+
+	var out jsonDerived
+	if err := xml.Unmarshal(b, &JSONTagged{V: &out}); err != nil {
+		t.Fatal(err)
+	}
+	if out.ID != 1 || out.Name != "n" || out.Label != "label" || out.jsonBase.Name != "" {
+		t.Errorf("want promoted fields decoded, got %+v", out)
+	}
+	out = jsonDerived{jsonAudit: &jsonAudit{}}
+	if err := xml.Unmarshal(b, &JSONTagged{V: &out}); err != nil || out.Author != "moga" {
+		t.Errorf("want fields promoted through a set pointer decoded, got %+v: %v", out, err)
+	}
+
+	in.jsonAudit = nil
+	if b, err = xml.Marshal(JSONTagged{Name: xml.Name{Local: "d"}, V: in}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "author") {
+		t.Errorf("want fields of a nil embedded pointer left out, got %s", b)
+	}
+}
@@ -0,0 +1,20 @@
+package soap
+
+import (
+	"syscall"
+	"time"
+)
+
+// setKeepAliveInterval set the time between keep-alive probes of socket fd
+func setKeepAliveInterval(fd uintptr, interval time.Duration) error {
+	return syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_KEEPINTVL, roundSeconds(interval))
+}
+
+// roundSeconds return d in whole seconds, rounded up, at least one
+func roundSeconds(d time.Duration) int {
+	secs := int((d + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return secs
+}
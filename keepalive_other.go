@@ -0,0 +1,11 @@
+//go:build !linux
+
+package soap
+
+import "time"
+
+// setKeepAliveInterval leave the interval to the idle time set by the
+// dialer, the interval not being settable on its own here
+func setKeepAliveInterval(fd uintptr, interval time.Duration) error {
+	return nil
+}
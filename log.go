@@ -0,0 +1,102 @@
+package soap
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// LogLevels levels at which the events of WithLogger are emitted
+type LogLevels struct {
+	// Request an attempt to send a request
+	Request slog.Level
+	// Response the status and headers of a response were received
+	Response slog.Level
+	// Fault a SOAP fault was decoded
+	Fault slog.Level
+	// Retry a failed attempt is about to be retried
+	Retry slog.Level
+}
+
+// defaultLogLevels keep the per call events out of Info logs
+var defaultLogLevels = LogLevels{
+	Request:  slog.LevelDebug,
+	Response: slog.LevelDebug,
+	Fault:    slog.LevelWarn,
+	Retry:    slog.LevelWarn,
+}
+
+// WithLogger emit structured events of every call to logger, at the levels
+// set by WithLogLevels, Debug for requests and responses and Warn for
+// faults and retries otherwise. Events are named "soap request", "soap
+// response", "soap fault" and "soap retry" and carry, where known, the
+// attributes endpoint, action, attempt, status, duration, bytes, code and
+// error. Headers and envelopes are never logged, and the password of an
+// endpoint URL is redacted; a ReplaceAttr of the logger's handler can
+// redact further, e.g. the query of the endpoint.
+func WithLogger(logger *slog.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithLogLevels emit the events of WithLogger at levels
+func WithLogLevels(levels LogLevels) Option {
+	return func(c *Client) {
+		c.logLevels = &levels
+	}
+}
+
+// levels return the levels of the events of WithLogger
+func (s *Client) levels() LogLevels {
+	if s.logLevels != nil {
+		return *s.logLevels
+	}
+	return defaultLogLevels
+}
+
+// requestAttrs return the attributes identifying the attempt of req
+func requestAttrs(req *http.Request, attempt int) []slog.Attr {
+	return []slog.Attr{
+		slog.String("endpoint", req.URL.Redacted()),
+		slog.String("action", req.Header.Get("SOAPAction")),
+		slog.Int("attempt", attempt),
+	}
+}
+
+// logRequest emit the request event of the attempt sending req
+func (s *Client) logRequest(req *http.Request, attempt int) {
+	if s.logger == nil {
+		return
+	}
+	s.logger.LogAttrs(req.Context(), s.levels().Request, "soap request",
+		append(requestAttrs(req, attempt), slog.Int64("bytes", req.ContentLength))...)
+}
+
+// logResponse emit the response event of the attempt sending req, started
+// at start, or the retry event when retry is set
+func (s *Client) logResponse(req *http.Request, attempt int, start time.Time, res *http.Response, err error, retry bool) {
+	if s.logger == nil {
+		return
+	}
+	attrs := append(requestAttrs(req, attempt), slog.Duration("duration", time.Since(start)))
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	} else {
+		attrs = append(attrs, slog.Int("status", res.StatusCode), slog.Int64("bytes", res.ContentLength))
+	}
+	if retry {
+		s.logger.LogAttrs(req.Context(), s.levels().Retry, "soap retry", attrs...)
+		return
+	}
+	s.logger.LogAttrs(req.Context(), s.levels().Response, "soap response", attrs...)
+}
+
+// logFault emit the fault event of fault
+func (s *Client) logFault(fault *Fault) {
+	if s.logger == nil {
+		return
+	}
+	s.logger.LogAttrs(context.Background(), s.levels().Fault, "soap fault", slog.String("code", fault.Code))
+}
@@ -0,0 +1,76 @@
+package soap_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/sait/soapc"
+)
+
+func TestClientLogger(t *testing.T) {
+	var calls int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(faultEnvelope))
+	}))
+	defer ts.Close()
+
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	url := strings.Replace(ts.URL, "http://", "http://user:secret@", 1)
+	client := NewClient(url, false, nil, WithLogger(logger), WithRetry(2, time.Millisecond),
+		WithHeaders(map[string]string{"Authorization": "Bearer token"}))
+	if _, err := client.Call("urn:DoThing", testRequest{Message: "test"}); err == nil {
+		t.Fatal("want fault")
+	}
+	if strings.Contains(buf.String(), "secret") || strings.Contains(buf.String(), "token") {
+		t.Errorf("want credentials redacted in\n%s", buf.String())
+	}
+
+	var events []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, event)
+	}
+	expected := []struct{ msg, level string }{
+		{"soap request", "DEBUG"},
+		{"soap retry", "WARN"},
+		{"soap request", "DEBUG"},
+		{"soap response", "DEBUG"},
+		{"soap fault", "WARN"},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("want %d events, got\n%s", len(expected), buf.String())
+	}
+	for i, e := range expected {
+		if events[i]["msg"] != e.msg || events[i]["level"] != e.level {
+			t.Errorf("event %d: want %s at %s, got %v", i, e.msg, e.level, events[i])
+		}
+	}
+	if events[1]["status"] != float64(http.StatusServiceUnavailable) || events[3]["action"] != "urn:DoThing" ||
+		events[3]["attempt"] != float64(2) || events[4]["code"] != "soap:Server" {
+		t.Errorf("unexpected attributes in\n%s", buf.String())
+	}
+
+	buf.Reset()
+	calls = 1
+	client = NewClient(ts.URL, false, nil, WithLogger(logger), WithLogLevels(LogLevels{Fault: slog.LevelError}))
+	client.Call("", testRequest{Message: "test"})
+	if !strings.Contains(buf.String(), `"level":"ERROR","msg":"soap fault"`) {
+		t.Errorf("want fault logged at configured level in\n%s", buf.String())
+	}
+}
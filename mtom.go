@@ -0,0 +1,421 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// xopNamespace XML-binary Optimized Packaging namespace
+const xopNamespace = "http://www.w3.org/2004/08/xop/include"
+
+// Attachment MIME part of a multipart (MTOM or SwA) message other than
+// the root SOAP part
+type Attachment struct {
+	ContentID   string
+	ContentType string
+	Header      textproto.MIMEHeader
+	Data        []byte
+}
+
+// Attachment return the attachment with Content-ID cid, with or without
+// angle brackets or a cid: prefix, nil if none
+func (r *Response) Attachment(cid string) *Attachment {
+	cid = normalizeContentID(cid)
+	for i := range r.Attachments {
+		if r.Attachments[i].ContentID == cid {
+			return &r.Attachments[i]
+		}
+	}
+	return nil
+}
+
+// rootContentID Content-ID of the SOAP part of multipart requests
+const rootContentID = "<root.message@soapc>"
+
+// attachedRequest envelope sent as the root part of a multipart/related
+// request followed by attachments
+type attachedRequest struct {
+	envelope    Envelope
+	attachments []Attachment
+}
+
+// WithMultipartBoundary generate the boundary of multipart requests with
+// boundary instead of a random one, e.g. a fixed boundary for a server
+// whose MIME parser mishandles some characters. A boundary that is not 1
+// to 70 characters from RFC 2046 fails the call.
+func WithMultipartBoundary(boundary func() string) Option {
+	return func(c *Client) {
+		c.multipartBoundary = boundary
+	}
+}
+
+// CallAttachments SOAP client API call sending request as the root part of
+// a SOAP with Attachments multipart/related request followed by
+// attachments, referenced from the envelope by their cid: Content-ID.
+// Attachments without a Content-Type are sent as application/octet-stream.
+func (s *Client) CallAttachments(soapAction string, request interface{}, attachments ...Attachment) (*Response, error) {
+	ctx := context.Background()
+	var res *Response
+	err := s.withToken(ctx, s.envelope(soapAction, request), func(envelope Envelope) (err error) {
+		res, err = s.roundTrip(ctx, soapAction, attachedRequest{envelope, attachments}, nil)
+		return
+	})
+	return res, err
+}
+
+// encodeMultipart return the multipart/related body made of the encoded
+// envelope and attachments, with its Content-Type
+func (s *Client) encodeMultipart(envelope []byte, attachments []Attachment) (*bytes.Buffer, string, error) {
+	buffer := new(bytes.Buffer)
+	writer := multipart.NewWriter(buffer)
+	if s.multipartBoundary != nil {
+		if err := writer.SetBoundary(s.multipartBoundary()); err != nil {
+			return nil, "", fmt.Errorf("failed to encode multipart request: %w", err)
+		}
+	}
+	root, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type": {`text/xml; charset="utf-8"`},
+		"Content-Id":   {rootContentID},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	root.Write(envelope)
+	for _, attachment := range attachments {
+		header := make(textproto.MIMEHeader, len(attachment.Header)+3)
+		for key, values := range attachment.Header {
+			header[key] = values
+		}
+		contentType := attachment.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		header.Set("Content-Type", contentType)
+		header.Set("Content-Id", "<"+normalizeContentID(attachment.ContentID)+">")
+		header.Set("Content-Transfer-Encoding", "binary")
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, "", err
+		}
+		part.Write(attachment.Data)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+	return buffer, mime.FormatMediaType("multipart/related", map[string]string{
+		"type":     "text/xml",
+		"start":    rootContentID,
+		"boundary": writer.Boundary(),
+	}), nil
+}
+
+// isMultipart report whether contentType is a multipart/related response
+func isMultipart(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && strings.EqualFold(mediaType, "multipart/related")
+}
+
+// splitMultipart split a multipart/related body into its root SOAP part
+// and attachments. The root is the part named by the start parameter,
+// the first one otherwise. xop:Include references within an
+// application/xop+xml root are replaced by the base64 content of the part
+// they refer to, so the envelope decodes like an inline one. The read
+// buffers are zeroed when zero is set.
+func splitMultipart(contentType string, body []byte, zero bool) (root []byte, attachments []Attachment, err error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse multipart Content-Type: %s", err.Error())
+	}
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, nil, fmt.Errorf("multipart response has no boundary")
+	}
+	start := normalizeContentID(params["start"])
+
+	var (
+		parts    []Attachment
+		rootPart = -1
+	)
+	mr := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read multipart response: %s", err.Error())
+		}
+		data, err := readBody(part, -1, zero)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read multipart response: %s", err.Error())
+		}
+		a := Attachment{
+			ContentID:   normalizeContentID(part.Header.Get("Content-ID")),
+			ContentType: part.Header.Get("Content-Type"),
+			Header:      part.Header,
+			Data:        data,
+		}
+		if rootPart < 0 && (start == "" || a.ContentID == start) {
+			rootPart = len(parts)
+		}
+		parts = append(parts, a)
+	}
+	if rootPart < 0 {
+		return nil, nil, fmt.Errorf("multipart response has no root part %q", start)
+	}
+	rootType := parts[rootPart].ContentType
+	root = parts[rootPart].Data
+	attachments = append(parts[:rootPart:rootPart], parts[rootPart+1:]...)
+
+	mediaType, _, err := mime.ParseMediaType(rootType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse root part Content-Type: %s", err.Error())
+	}
+	switch strings.ToLower(mediaType) {
+	case "application/xop+xml":
+		root, err = resolveXOP(root, attachments)
+	case "text/xml", "application/soap+xml":
+	default:
+		err = fmt.Errorf("unexpected root part Content-Type %q", rootType)
+	}
+	return
+}
+
+// resolveXOP replace the xop:Include elements of root by the base64
+// content of the attachment they reference
+func resolveXOP(root []byte, attachments []Attachment) ([]byte, error) {
+	var (
+		resolved bytes.Buffer
+		last     int64
+	)
+	d := xml.NewDecoder(bytes.NewReader(root))
+	for {
+		offset := d.InputOffset()
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse xop document: %s", err.Error())
+		}
+		se, ok := token.(xml.StartElement)
+		if !ok || se.Name.Space != xopNamespace || se.Name.Local != "Include" {
+			continue
+		}
+		var href string
+		for _, attr := range se.Attr {
+			if attr.Name.Local == "href" {
+				href = attr.Value
+			}
+		}
+		var data []byte
+		cid := normalizeContentID(href)
+		for _, a := range attachments {
+			if a.ContentID == cid {
+				data = a.Data
+				break
+			}
+		}
+		if data == nil {
+			return nil, fmt.Errorf("xop:Include references unknown part %q", href)
+		}
+		if err := d.Skip(); err != nil {
+			return nil, fmt.Errorf("failed to parse xop document: %s", err.Error())
+		}
+		resolved.Write(root[last:offset])
+		resolved.WriteString(base64.StdEncoding.EncodeToString(data))
+		last = d.InputOffset()
+	}
+	resolved.Write(root[last:])
+	return resolved.Bytes(), nil
+}
+
+// normalizeContentID return id without cid: scheme, URL escaping or
+// angle brackets, so Content-ID headers and references compare equal
+func normalizeContentID(id string) string {
+	id = strings.TrimSpace(id)
+	if strings.HasPrefix(strings.ToLower(id), "cid:") {
+		id = id[len("cid:"):]
+		if unescaped, err := url.PathUnescape(id); err == nil {
+			id = unescaped
+		}
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(id, "<"), ">")
+}
+
+// MultipartResponse SOAP response whose attachments are streamed from the
+// response body on demand instead of being read upfront. It must be
+// closed to release the connection.
+type MultipartResponse struct {
+	StatusCode int
+	Header     http.Header
+	// Body root SOAP part; xop:Include references are left in place
+	Body []byte
+
+	body    io.Closer
+	cancel  context.CancelFunc
+	reader  *multipart.Reader
+	pending []Attachment
+}
+
+// CallMultipart SOAP client API call reading only the root part of a
+// multipart (MTOM or SwA) response; the attachments are read as they are
+// opened with Attachment. A non-multipart response has no attachments.
+// The timeout of WithTimeouts and the watchdog of WithReadIdleTimeout
+// apply up to the root part.
+func (s *Client) CallMultipart(soapAction string, request interface{}) (*MultipartResponse, error) {
+	ctx := context.Background()
+	var response *MultipartResponse
+	err := s.withToken(ctx, s.envelope(soapAction, request), func(envelope Envelope) (err error) {
+		response, err = s.callMultipart(ctx, soapAction, envelope)
+		return
+	})
+	return response, err
+}
+
+func (s *Client) callMultipart(ctx context.Context, soapAction string, envelope Envelope) (*MultipartResponse, error) {
+	// the context outlives the call, the attachments being read after it
+	// returns: the timeout is stopped once the root part is read
+	ctx, cancel := context.WithCancel(ctx)
+	timeout := s.startHeadTimeout(ctx, soapAction, cancel)
+	response, err := s.readRootPart(ctx, soapAction, envelope, cancel)
+	if !timeout.stop() {
+		if response != nil {
+			response.Close()
+		}
+		var transportErr *TransportError
+		if errors.As(err, &transportErr) {
+			err = &TransportError{Kind: TransportTimeout, Err: context.DeadlineExceeded}
+		} else {
+			err = fmt.Errorf("failed to read multipart response: %w", context.DeadlineExceeded)
+		}
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return response, nil
+}
+
+// readRootPart send envelope and read the response up to its root part,
+// the request being aborted through cancel when the body stalls
+func (s *Client) readRootPart(ctx context.Context, soapAction string, envelope Envelope, cancel context.CancelFunc) (*MultipartResponse, error) {
+	res, _, err := s.send(ctx, soapAction, envelope, nil)
+	if err != nil {
+		return nil, err
+	}
+	s.watchBody(res, cancel)
+	if r, ok := res.Body.(*stallReader); ok {
+		defer r.disarm()
+	}
+	body, hint, err := s.checkResponse(res)
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	response := &MultipartResponse{
+		StatusCode: res.StatusCode,
+		Header:     res.Header,
+		body:       res.Body,
+		cancel:     cancel,
+	}
+	contentType := res.Header.Get("Content-Type")
+	if !isMultipart(contentType) {
+		defer res.Body.Close()
+		if response.Body, err = readBody(body, hint, s.zeroBuffers); err != nil {
+			return nil, fmt.Errorf("failed to read SOAP body: %w", err)
+		}
+		if err = checkDTD(response.Body); err != nil {
+			return nil, err
+		}
+		s.inspect(response.Body)
+		return response, nil
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["boundary"] == "" {
+		res.Body.Close()
+		return nil, fmt.Errorf("multipart response has no boundary")
+	}
+	start := normalizeContentID(params["start"])
+	response.reader = multipart.NewReader(body, params["boundary"])
+	for {
+		part, err := response.reader.NextPart()
+		if err != nil {
+			res.Body.Close()
+			if err == io.EOF {
+				return nil, fmt.Errorf("multipart response has no root part %q", start)
+			}
+			return nil, fmt.Errorf("failed to read multipart response: %s", err.Error())
+		}
+		data, err := readBody(part, -1, s.zeroBuffers)
+		if err != nil {
+			res.Body.Close()
+			return nil, fmt.Errorf("failed to read multipart response: %w", err)
+		}
+		cid := normalizeContentID(part.Header.Get("Content-ID"))
+		if start == "" || cid == start {
+			if err = checkDTD(data); err != nil {
+				res.Body.Close()
+				return nil, err
+			}
+			response.Body = data
+			s.inspect(data)
+			return response, nil
+		}
+		// parts before the root, rare in practice, are kept in memory
+		response.pending = append(response.pending, Attachment{
+			ContentID:   cid,
+			ContentType: part.Header.Get("Content-Type"),
+			Header:      part.Header,
+			Data:        data,
+		})
+	}
+}
+
+// Attachment return a reader of the attachment with Content-ID cid, with
+// or without angle brackets or a cid: prefix. Attachments are streamed in
+// the order they were sent: those preceding cid that were not opened yet
+// are skipped and can no longer be opened, as is any unread remainder of
+// the previously opened one.
+func (r *MultipartResponse) Attachment(cid string) (io.ReadCloser, error) {
+	cid = normalizeContentID(cid)
+	for i, a := range r.pending {
+		if a.ContentID == cid {
+			r.pending = append(r.pending[:i:i], r.pending[i+1:]...)
+			return io.NopCloser(bytes.NewReader(a.Data)), nil
+		}
+	}
+	if r.reader == nil {
+		return nil, fmt.Errorf("no attachment %q", cid)
+	}
+	for {
+		part, err := r.reader.NextPart()
+		if err == io.EOF {
+			return nil, fmt.Errorf("no attachment %q", cid)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read multipart response: %s", err.Error())
+		}
+		if normalizeContentID(part.Header.Get("Content-ID")) == cid {
+			return part, nil
+		}
+	}
+}
+
+// Close release the response body
+func (r *MultipartResponse) Close() error {
+	err := r.body.Close()
+	r.cancel()
+	return err
+}
@@ -0,0 +1,270 @@
+package soap_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/achiku/testsvr"
+	. "github.com/sait/soapc"
+)
+
+var (
+	mtomImage   = []byte{0x89, 'P', 'N', 'G', 0x00, 0xff, 0x10}
+	mtomInvoice = []byte("%PDF-1.4 invoice")
+)
+
+type mtomDocument struct {
+	XMLName xml.Name     `xml:"urn:docs getDocumentResponse"`
+	Name    string       `xml:"name"`
+	Image   Base64Binary `xml:"image"`
+	Invoice Base64Binary `xml:"invoice"`
+}
+
+func mtomResponse(logger testsvr.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+
+		// attachment first, so the root has to be found by the start parameter
+		part, _ := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"image/png"},
+			"Content-Id":   {"<image@example.org>"},
+		})
+		part.Write(mtomImage)
+		part, _ = mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {`application/xop+xml; charset=UTF-8; type="text/xml"`},
+			"Content-Id":   {"<root@example.org>"},
+		})
+		part.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <getDocumentResponse xmlns="urn:docs" xmlns:xop="http://www.w3.org/2004/08/xop/include">
+      <name>scan</name>
+      <image><xop:Include href="cid:image%40example.org"/></image>
+      <invoice><xop:Include href="cid:invoice@example.org"></xop:Include></invoice>
+    </getDocumentResponse>
+  </soap:Body>
+</soap:Envelope>`))
+		part, _ = mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {"application/pdf"},
+			"Content-Id":   {"<invoice@example.org>"},
+		})
+		part.Write(mtomInvoice)
+		mw.Close()
+
+		w.Header().Set("Content-Type", `multipart/related; type="application/xop+xml"; `+
+			`start="<root@example.org>"; start-info="text/xml"; boundary=`+mw.Boundary())
+		w.Write(buf.Bytes())
+	}
+}
+
+func TestMTOMResponse(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(map[string]testsvr.CreateHandler{
+		"/mtom": mtomResponse,
+	}, t))
+	defer ts.Close()
+
+	client := NewClient(ts.URL+"/mtom", false, nil)
+	res, err := client.CallFull("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc mtomDocument
+	env := Envelope{Body: Body{Content: &doc}}
+	if err := xml.Unmarshal(res.Body, &env); err != nil {
+		t.Fatalf("%s\n%s", err, res.Body)
+	}
+	if doc.Name != "scan" || !bytes.Equal(doc.Image, mtomImage) || !bytes.Equal(doc.Invoice, mtomInvoice) {
+		t.Errorf("unexpected document %+v", doc)
+	}
+
+	if len(res.Attachments) != 2 {
+		t.Fatalf("want 2 attachments, got %d", len(res.Attachments))
+	}
+	a := res.Attachment("<invoice@example.org>")
+	if a == nil || a.ContentType != "application/pdf" || !bytes.Equal(a.Data, mtomInvoice) {
+		t.Errorf("unexpected invoice attachment %+v", a)
+	}
+	if res.Attachment("cid:image%40example.org") == nil {
+		t.Error("want image attachment by cid reference")
+	}
+}
+
+func TestMultipartResponseLazy(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(map[string]testsvr.CreateHandler{
+		"/mtom": mtomResponse,
+	}, t))
+	defer ts.Close()
+
+	client := NewClient(ts.URL+"/mtom", false, nil)
+	res, err := client.CallMultipart("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	if !strings.Contains(string(res.Body), `<xop:Include href="cid:invoice@example.org">`) {
+		t.Errorf("want xop:Include left in root part, got %s", res.Body)
+	}
+
+	invoice, err := res.Attachment("cid:invoice@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(invoice)
+	invoice.Close()
+	if err != nil || !bytes.Equal(data, mtomInvoice) {
+		t.Errorf("unexpected invoice %q: %v", data, err)
+	}
+	// sent before the root part, so still available
+	image, err := res.Attachment("<image@example.org>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ = io.ReadAll(image); !bytes.Equal(data, mtomImage) {
+		t.Errorf("unexpected image %q", data)
+	}
+	if _, err := res.Attachment("invoice@example.org"); err == nil {
+		t.Error("want error reopening a streamed attachment")
+	}
+}
+
+func TestMultipartResponseGuards(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mw := multipart.NewWriter(w)
+		w.Header().Set("Content-Type", `multipart/related; type="application/xop+xml"; boundary=`+mw.Boundary())
+		root := personEnvelope
+		if r.URL.Path == "/dtd" {
+			root = `<!DOCTYPE Envelope [<!ENTITY a "a">]>` + strings.SplitN(personEnvelope, "\n", 2)[1]
+		}
+		pause := func(d time.Duration) bool {
+			w.(http.Flusher).Flush()
+			select {
+			case <-time.After(d):
+				return true
+			case <-r.Context().Done():
+				return false
+			}
+		}
+		part, _ := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"application/xop+xml"}})
+		if r.URL.Path == "/stall" {
+			part.Write([]byte(root[:len(root)/2]))
+			if !pause(time.Second) {
+				return
+			}
+		}
+		part.Write([]byte(root))
+		// the boundary ending the root part goes out before the pause
+		part, _ = mw.CreatePart(textproto.MIMEHeader{"Content-Id": {"<invoice@example.org>"}})
+		if !pause(150 * time.Millisecond) {
+			return
+		}
+		part.Write(mtomInvoice)
+		mw.Close()
+	}))
+	defer ts.Close()
+
+	if _, err := NewClient(ts.URL+"/dtd", false, nil).CallMultipart("", testRequest{Message: "test"}); !errors.Is(err, ErrDTDNotAllowed) {
+		t.Errorf("want DTD in the root part rejected, got %v", err)
+	}
+
+	for _, tc := range []struct {
+		opt  Option
+		want error
+	}{
+		{WithTimeouts(50*time.Millisecond, nil), context.DeadlineExceeded},
+		{WithReadIdleTimeout(50 * time.Millisecond), ErrReadStalled},
+	} {
+		start := time.Now()
+		_, err := NewClient(ts.URL+"/stall", false, nil, tc.opt).CallMultipart("", testRequest{Message: "test"})
+		if !errors.Is(err, tc.want) {
+			t.Errorf("want %v, got %v", tc.want, err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("want stalled root part abandoned early, took %s", elapsed)
+		}
+	}
+
+	client := NewClient(ts.URL+"/late", false, nil,
+		WithTimeouts(50*time.Millisecond, nil), WithReadIdleTimeout(50*time.Millisecond))
+	res, err := client.CallMultipart("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Close()
+	invoice, err := res.Attachment("invoice@example.org")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := io.ReadAll(invoice); err != nil || !bytes.Equal(data, mtomInvoice) {
+		t.Errorf("want attachment read past the timeouts, got %q: %v", data, err)
+	}
+}
+
+func TestCallAttachments(t *testing.T) {
+	var (
+		contentType string
+		parts       []*multipart.Part
+		data        [][]byte
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentType = r.Header.Get("Content-Type")
+		_, params, _ := mime.ParseMediaType(contentType)
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		for {
+			part, err := mr.NextPart()
+			if err != nil {
+				break
+			}
+			b, _ := io.ReadAll(part)
+			parts = append(parts, part)
+			data = append(data, b)
+		}
+		w.Write([]byte(`<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body/></soap:Envelope>`))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, false, nil, WithMultipartBoundary(func() string {
+		return "partner-boundary"
+	}))
+	_, err := client.CallAttachments("", testRequest{Message: "test"},
+		Attachment{ContentID: "cid:image@example.org", ContentType: "image/png", Data: mtomImage},
+		Attachment{ContentID: "<invoice@example.org>", Data: mtomInvoice})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if mediaType != "multipart/related" || params["boundary"] != "partner-boundary" ||
+		params["type"] != "text/xml" || params["start"] != "<root.message@soapc>" {
+		t.Errorf("unexpected Content-Type %s", contentType)
+	}
+	if len(parts) != 3 {
+		t.Fatalf("want 3 parts, got %d", len(parts))
+	}
+	if parts[0].Header.Get("Content-Id") != params["start"] || !strings.Contains(string(data[0]), "<message>test</message>") {
+		t.Errorf("unexpected root part %v %s", parts[0].Header, data[0])
+	}
+	if parts[1].Header.Get("Content-Id") != "<image@example.org>" || parts[1].Header.Get("Content-Type") != "image/png" ||
+		!bytes.Equal(data[1], mtomImage) {
+		t.Errorf("unexpected image part %v %q", parts[1].Header, data[1])
+	}
+	if parts[2].Header.Get("Content-Type") != "application/octet-stream" || !bytes.Equal(data[2], mtomInvoice) {
+		t.Errorf("unexpected invoice part %v %q", parts[2].Header, data[2])
+	}
+
+	client = NewClient(ts.URL, false, nil, WithMultipartBoundary(func() string {
+		return "boundary@partner"
+	}))
+	if _, err := client.CallAttachments("", testRequest{Message: "test"}); err == nil {
+		t.Error("want error for an invalid boundary")
+	}
+}
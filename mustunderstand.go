@@ -0,0 +1,118 @@
+package soap
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// actors addressing a header block to the ultimate receiver of a message
+var ultimateActors = map[string]bool{
+	"":                   true,
+	ActorNext:            true,
+	RoleNext:             true,
+	RoleUltimateReceiver: true,
+}
+
+// NotUnderstoodBlocks return the names of the Unknown header blocks marked
+// mustUnderstand and addressed to the ultimate receiver. A server decoding
+// the header blocks it supports into Content must answer a non-empty
+// result with a MustUnderstandFault instead of processing the message.
+func (h *Header) NotUnderstoodBlocks() []xml.Name {
+	if h == nil {
+		return nil
+	}
+	var names []xml.Name
+	for _, raw := range h.Unknown {
+		if len(raw.Tokens) == 0 {
+			continue
+		}
+		start, ok := raw.Tokens[0].(xml.StartElement)
+		if !ok {
+			continue
+		}
+		var mustUnderstand bool
+		actor := ""
+		for _, attr := range start.Attr {
+			if attr.Name.Space != envelopeNamespace && attr.Name.Space != envelope12Namespace {
+				continue
+			}
+			switch attr.Name.Local {
+			case "mustUnderstand":
+				mustUnderstand = attr.Value == "1" || attr.Value == "true"
+			case "actor", "role":
+				actor = attr.Value
+			}
+		}
+		if mustUnderstand && ultimateActors[actor] {
+			names = append(names, raw.XMLName)
+		}
+	}
+	return names
+}
+
+// MustUnderstandFault return the standard fault reporting header blocks
+// that were not understood, listed in the faultstring. The faultcode is
+// left unprefixed so that it resolves to the envelope namespace, the
+// default one of an encoded Envelope. SOAP 1.2 responses also carry
+// NotUnderstoodHeader(names).
+func MustUnderstandFault(names []xml.Name) *Fault {
+	blocks := make([]string, len(names))
+	for i, name := range names {
+		blocks[i] = name.Local
+		if name.Space != "" {
+			blocks[i] = "{" + name.Space + "}" + name.Local
+		}
+	}
+	return &Fault{
+		Code:     "MustUnderstand",
+		String:   "Mandatory SOAP header blocks not understood: " + strings.Join(blocks, ", "),
+		CodeName: xml.Name{Space: envelopeNamespace, Local: "MustUnderstand"},
+	}
+}
+
+// NotUnderstood SOAP 1.2 header block naming a header block not understood
+type NotUnderstood struct {
+	Name xml.Name
+}
+
+// MarshalXML encode the qname attribute along with its prefix declaration
+func (n NotUnderstood) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	start = xml.StartElement{Name: xml.Name{Space: envelope12Namespace, Local: "NotUnderstood"}}
+	qname := n.Name.Local
+	if n.Name.Space != "" {
+		qname = "nu:" + qname
+		start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xmlns:nu"}, Value: n.Name.Space})
+	}
+	start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "qname"}, Value: qname})
+	if err := e.EncodeToken(start); err != nil {
+		return err
+	}
+	return e.EncodeToken(start.End())
+}
+
+// NotUnderstoodHeader return the header blocks of a SOAP 1.2
+// MustUnderstand fault response, one NotUnderstood per name, to be used as
+// Header Content
+func NotUnderstoodHeader(names []xml.Name) []interface{} {
+	blocks := make([]interface{}, len(names))
+	for i, name := range names {
+		blocks[i] = NotUnderstood{Name: name}
+	}
+	return blocks
+}
+
+// MustUnderstandEnvelope return the response envelope answering names
+// not understood in version: the MustUnderstandFault, along with the
+// NotUnderstoodHeader blocks identifying each qname under SOAP12, as the
+// 1.2 spec requires.
+func MustUnderstandEnvelope(names []xml.Name, version SOAPVersion) Envelope {
+	fault := MustUnderstandFault(names)
+	envelope := Envelope{Body: Body{Fault: fault}}
+	if version == SOAP12 {
+		fault.Version = SOAP12
+		fault.CodeName = xml.Name{Space: envelope12Namespace, Local: "MustUnderstand"}
+		envelope.Version = SOAP12
+		envelope.Header = &Header{Content: NotUnderstoodHeader(names)}
+	}
+	return envelope
+}
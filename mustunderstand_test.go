@@ -0,0 +1,91 @@
+package soap_test
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	. "github.com/sait/soapc"
+)
+
+const mustUnderstandEnvelope = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Header>
+    <ex:myResponseHeader xmlns:ex="urn:example" soap:mustUnderstand="1"><transactionId>100</transactionId></ex:myResponseHeader>
+    <sec:Token xmlns:sec="urn:security" soap:mustUnderstand="1">secret</sec:Token>
+    <sec:Trace xmlns:sec="urn:security" soap:mustUnderstand="0">on</sec:Trace>
+    <sec:Route xmlns:sec="urn:security" soap:mustUnderstand="1" soap:actor="urn:gateway">a</sec:Route>
+  </soap:Header>
+  <soap:Body><echo xmlns="urn:example"><message>hello</message></echo></soap:Body>
+</soap:Envelope>`
+
+func TestNotUnderstoodBlocks(t *testing.T) {
+	var (
+		header forwardHeader
+		body   forwardBody
+	)
+	env := Envelope{
+		Header: &Header{Content: &header},
+		Body:   Body{Content: &body},
+	}
+	if err := xml.Unmarshal([]byte(mustUnderstandEnvelope), &env); err != nil {
+		t.Fatal(err)
+	}
+	names := env.Header.NotUnderstoodBlocks()
+	if len(names) != 1 || names[0] != (xml.Name{Space: "urn:security", Local: "Token"}) {
+		t.Fatalf("want only the Token block, got %v", names)
+	}
+
+	fault := MustUnderstandFault(names)
+	b, err := xml.Marshal(Envelope{Body: Body{Fault: fault}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := Envelope{Body: Body{Content: &struct{}{}}}
+	if err := xml.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Body.Fault == nil || decoded.Body.Fault.CodeName != fault.CodeName {
+		t.Errorf("want faultcode %v in\n%s", fault.CodeName, b)
+	}
+	if !strings.Contains(fault.String, "{urn:security}Token") {
+		t.Errorf("want block named in faultstring, got %q", fault.String)
+	}
+
+	b, err = xml.Marshal(Header{Content: NotUnderstoodHeader(names)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<NotUnderstood xmlns="http://www.w3.org/2003/05/soap-envelope" xmlns:nu="urn:security" qname="nu:Token"></NotUnderstood>`
+	if !strings.Contains(string(b), want) {
+		t.Errorf("want %s in\n%s", want, b)
+	}
+}
+
+func TestMustUnderstandEnvelope(t *testing.T) {
+	names := []xml.Name{{Space: "urn:security", Local: "Token"}, {Local: "Trace"}}
+	b, err := xml.Marshal(MustUnderstandEnvelope(names, SOAP12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<Envelope xmlns="http://www.w3.org/2003/05/soap-envelope">`,
+		`xmlns:nu="urn:security" qname="nu:Token"`,
+		`qname="Trace"`,
+		`<Value xmlns="http://www.w3.org/2003/05/soap-envelope">env:MustUnderstand</Value>`,
+	} {
+		if !strings.Contains(string(b), want) {
+			t.Errorf("want %s in\n%s", want, b)
+		}
+	}
+	if header := strings.Index(string(b), "NotUnderstood"); header < 0 || header > strings.Index(string(b), "Fault") {
+		t.Errorf("want NotUnderstood header blocks before the fault in\n%s", b)
+	}
+
+	b, err = xml.Marshal(MustUnderstandEnvelope(names, SOAP11))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "NotUnderstood") || !strings.Contains(string(b), "<faultcode>MustUnderstand</faultcode>") {
+		t.Errorf("want plain SOAP 1.1 fault, got\n%s", b)
+	}
+}
@@ -0,0 +1,75 @@
+package soap
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// defaultMaxRedirects redirects followed unless set by MaxRedirects
+const defaultMaxRedirects = 10
+
+// RedirectError reasons
+const (
+	// RedirectTooMany more redirects than allowed by MaxRedirects
+	RedirectTooMany = "too-many"
+	// RedirectLoop redirect to a URL already requested
+	RedirectLoop = "loop"
+	// RedirectDowngrade redirect from https to http
+	RedirectDowngrade = "downgrade"
+)
+
+// RedirectError redirect refused by the client's redirect policy
+type RedirectError struct {
+	// URL redirect target
+	URL string
+	// Redirects number of redirects followed before
+	Redirects int
+	// Reason one of the Redirect reasons
+	Reason string
+}
+
+func (e *RedirectError) Error() string {
+	switch e.Reason {
+	case RedirectTooMany:
+		return fmt.Sprintf("redirect to %s refused: stopped after %d redirects", e.URL, e.Redirects)
+	case RedirectLoop:
+		return fmt.Sprintf("redirect to %s refused: redirect loop", e.URL)
+	case RedirectDowngrade:
+		return fmt.Sprintf("redirect to %s refused: downgrade from https to http", e.URL)
+	}
+	return fmt.Sprintf("redirect to %s refused: %s", e.URL, e.Reason)
+}
+
+// MaxRedirects follow at most n redirects, none when n is 0, failing the
+// call with a *RedirectError beyond. Defaults to 10.
+func MaxRedirects(n int) Option {
+	return func(c *Client) {
+		c.maxRedirects = n
+	}
+}
+
+// AllowInsecureRedirect set whether a redirect from https to http is
+// followed; by default it fails the call with a *RedirectError
+func AllowInsecureRedirect(allow bool) Option {
+	return func(c *Client) {
+		c.insecureRedirect = allow
+	}
+}
+
+// checkRedirect enforce the redirect policy, as http.Client.CheckRedirect
+func (s *Client) checkRedirect(req *http.Request, via []*http.Request) error {
+	target := req.URL.String()
+	redirects := len(via) - 1
+	if redirects >= s.maxRedirects {
+		return &RedirectError{URL: target, Redirects: redirects, Reason: RedirectTooMany}
+	}
+	for _, v := range via {
+		if v.URL.String() == target {
+			return &RedirectError{URL: target, Redirects: redirects, Reason: RedirectLoop}
+		}
+	}
+	if !s.insecureRedirect && via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme == "http" {
+		return &RedirectError{URL: target, Redirects: redirects, Reason: RedirectDowngrade}
+	}
+	return nil
+}
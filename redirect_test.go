@@ -0,0 +1,78 @@
+package soap_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/sait/soapc"
+)
+
+func TestRedirectPolicy(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/a", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/b", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/b", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/c", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/c", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(personEnvelope))
+	})
+	mux.HandleFunc("/loop", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/loop", http.StatusTemporaryRedirect)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+	req := testRequest{Message: "test"}
+
+	if _, err := NewClient(ts.URL+"/a", false, nil).Call("", req); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		url    string
+		opts   []Option
+		reason string
+	}{
+		{url: ts.URL + "/a", opts: []Option{MaxRedirects(1)}, reason: RedirectTooMany},
+		{url: ts.URL + "/b", opts: []Option{MaxRedirects(0)}, reason: RedirectTooMany},
+		{url: ts.URL + "/a", opts: []Option{MaxRedirects(2)}},
+		{url: ts.URL + "/loop", reason: RedirectLoop},
+	}
+	for _, c := range cases {
+		_, err := NewClient(c.url, false, nil, c.opts...).Call("", req)
+		var redirectErr *RedirectError
+		if c.reason == "" {
+			if err != nil {
+				t.Errorf("%s: %v", c.url, err)
+			}
+			continue
+		}
+		if !errors.As(err, &redirectErr) || redirectErr.Reason != c.reason {
+			t.Errorf("%s: want %s redirect error, got %v", c.url, c.reason, err)
+		}
+	}
+}
+
+func TestRedirectDowngrade(t *testing.T) {
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(personEnvelope))
+	}))
+	defer plain.Close()
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, plain.URL, http.StatusTemporaryRedirect)
+	}))
+	defer ts.Close()
+	req := testRequest{Message: "test"}
+
+	_, err := NewClient(ts.URL, true, nil).Call("", req)
+	var redirectErr *RedirectError
+	if !errors.As(err, &redirectErr) || redirectErr.Reason != RedirectDowngrade {
+		t.Errorf("want downgrade redirect error, got %v", err)
+	}
+	if _, err := NewClient(ts.URL, true, nil, AllowInsecureRedirect(true)).Call("", req); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !plan9
+
+package soap
+
+import (
+	"errors"
+	"syscall"
+)
+
+// isConnRefused report whether err is a refused connection
+func isConnRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
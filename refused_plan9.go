@@ -0,0 +1,9 @@
+package soap
+
+import "strings"
+
+// isConnRefused report whether err is a refused connection, Plan 9 having
+// no error number for it
+func isConnRefused(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "connection refused")
+}
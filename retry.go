@@ -0,0 +1,51 @@
+package soap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// WithRetry send a request up to attempts times in total while it fails to
+// reach the service or is answered with 502, 503 or 504, waiting backoff
+// between attempts. Each attempt transmits the full envelope. SOAP faults
+// are not retried, whatever the status: the body of a 502, 503 or 504
+// response is read to tell a fault before retrying.
+func WithRetry(attempts int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retryAttempts = attempts
+		c.retryBackoff = backoff
+	}
+}
+
+// WithRetryNonFault also retry, under WithRetry, responses with an
+// unsuccessful status whose body, such as an empty one sent by a backend
+// being deployed, carries no SOAP fault: they are classified as transport
+// failures, while faults still are answers and are not retried. The body
+// of such responses is read before deciding.
+func WithRetryNonFault() Option {
+	return func(c *Client) {
+		c.retryNonFault = true
+	}
+}
+
+// bufferNonFault read the body of the unsuccessful res, left readable
+// again decompressed, and report whether it carries no SOAP fault
+func (s *Client) bufferNonFault(res *http.Response) (bool, error) {
+	body, hint, err := s.openBody(res)
+	if err != nil {
+		return false, err
+	}
+	data, err := readBody(body, hint, s.zeroBuffers)
+	if err != nil {
+		return false, fmt.Errorf("failed to read SOAP fault response body: %w", err)
+	}
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(data))
+	res.Header.Del("Content-Encoding")
+	res.ContentLength = int64(len(data))
+	res.Uncompressed = true
+	return parseFault(data, s.faultDetection) == nil, nil
+}
@@ -0,0 +1,149 @@
+package soap_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/sait/soapc"
+)
+
+func TestRetryResendsBody(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		mu.Lock()
+		bodies = append(bodies, string(b))
+		n := len(bodies)
+		mu.Unlock()
+		if n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(personEnvelope))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, false, nil, WithRetry(3, time.Millisecond))
+	if _, err := client.Call("", testRequest{Message: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("want 2 attempts, got %d", len(bodies))
+	}
+	if bodies[0] == "" || bodies[1] != bodies[0] {
+		t.Errorf("want the second attempt to resend\n%s\ngot\n%s", bodies[0], bodies[1])
+	}
+}
+
+func TestRetryNonFault(t *testing.T) {
+	var attempts int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		switch {
+		case r.URL.Path == "/fault":
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(faultEnvelope))
+		case attempts == 1:
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte(personEnvelope))
+		}
+	}))
+	defer ts.Close()
+
+	if _, err := NewClient(ts.URL, false, nil, WithRetry(3, time.Millisecond)).Call("", testRequest{Message: "test"}); err == nil {
+		t.Error("want empty 500 not retried by default")
+	}
+	attempts = 0
+	client := NewClient(ts.URL, false, nil, WithRetry(3, time.Millisecond), WithRetryNonFault())
+	if _, err := client.Call("", testRequest{Message: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if attempts != 2 {
+		t.Errorf("want empty 500 retried once, got %d attempts", attempts)
+	}
+
+	attempts = 0
+	client = NewClient(ts.URL+"/fault", false, nil, WithRetry(3, time.Millisecond), WithRetryNonFault())
+	_, err := client.Call("", testRequest{Message: "test"})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Fault == nil || string(httpErr.Body) != faultEnvelope {
+		t.Errorf("want fault with its body, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("want fault not retried, got %d attempts", attempts)
+	}
+}
+
+func TestRetryAttempts(t *testing.T) {
+	var attempts int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(personEnvelope))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, false, nil, WithRetry(3, time.Millisecond))
+	res, err := client.CallFull("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Attempts != 3 || len(res.RetryErrors) != 2 {
+		t.Fatalf("want 3 attempts and 2 retry errors, got %d and %v", res.Attempts, res.RetryErrors)
+	}
+	for _, err := range res.RetryErrors {
+		var httpErr *HTTPError
+		if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusServiceUnavailable || httpErr.URL != ts.URL {
+			t.Errorf("want 503 from %s, got %v", ts.URL, err)
+		}
+	}
+
+	attempts = 2
+	if res, err = client.CallFull("", testRequest{Message: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if res.Attempts != 1 || res.RetryErrors != nil {
+		t.Errorf("want a single attempt, got %d and %v", res.Attempts, res.RetryErrors)
+	}
+}
+
+func TestRetryFaultWithBackendStatus(t *testing.T) {
+	var attempts int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+		if r.URL.Path == "/fault" {
+			w.Write([]byte(faultEnvelope))
+		}
+	}))
+	defer ts.Close()
+
+	_, err := NewClient(ts.URL+"/fault", false, nil, WithRetry(3, time.Millisecond)).Call("", testRequest{Message: "test"})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Fault == nil || string(httpErr.Body) != faultEnvelope {
+		t.Errorf("want fault with its body, got %v", err)
+	}
+	if attempts != 1 {
+		t.Errorf("want 503 fault not retried, got %d attempts", attempts)
+	}
+
+	attempts = 0
+	if _, err := NewClient(ts.URL, false, nil, WithRetry(3, time.Millisecond)).Call("", testRequest{Message: "test"}); err == nil {
+		t.Error("want error after the last attempt")
+	}
+	if attempts != 3 {
+		t.Errorf("want empty 503 retried, got %d attempts", attempts)
+	}
+}
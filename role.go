@@ -0,0 +1,47 @@
+package soap
+
+import "encoding/xml"
+
+// Intermediary roles of SOAP 1.1 actors and SOAP 1.2 roles
+const (
+	// ActorNext SOAP 1.1 actor of the next node processing the message
+	ActorNext = "http://schemas.xmlsoap.org/soap/actor/next"
+	// RoleNext SOAP 1.2 role of the next node processing the message
+	RoleNext = "http://www.w3.org/2003/05/soap-envelope/role/next"
+	// RoleNone SOAP 1.2 role no node acts in: the block is informative
+	// and never processed
+	RoleNone = "http://www.w3.org/2003/05/soap-envelope/role/none"
+	// RoleUltimateReceiver SOAP 1.2 role of the final recipient, the
+	// default when no role is set
+	RoleUltimateReceiver = "http://www.w3.org/2003/05/soap-envelope/role/ultimateReceiver"
+)
+
+// HeaderBlock header block addressed to the intermediaries acting in Role,
+// to be used as, or listed in, Header Content:
+//
+//	soap.HeaderBlock{Content: routing, Role: soap.ActorNext}
+type HeaderBlock struct {
+	Content interface{}
+	// Role URI of the nodes the block targets, such as RoleNext or an
+	// intermediary specific URI; the ultimate receiver when empty
+	Role string
+	// Version SOAP version of the envelope, encoding Role as the 1.1
+	// actor attribute when unset and as the 1.2 role attribute under
+	// SOAP12
+	Version SOAPVersion
+}
+
+// MarshalXML encode Content with the actor or role attribute
+func (b HeaderBlock) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	if name, ok := xmlNameOf(b.Content); ok {
+		start.Name = name
+	}
+	if b.Role != "" {
+		attr := xml.Attr{Name: xml.Name{Space: envelopeNamespace, Local: "actor"}, Value: b.Role}
+		if b.Version == SOAP12 {
+			attr.Name = xml.Name{Space: envelope12Namespace, Local: "role"}
+		}
+		start.Attr = append(start.Attr, attr)
+	}
+	return enc.EncodeElement(b.Content, start)
+}
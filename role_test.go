@@ -0,0 +1,57 @@
+package soap_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"testing"
+
+	. "github.com/sait/soapc"
+)
+
+type routing struct {
+	XMLName xml.Name `xml:"urn:esb Routing"`
+	Target  string   `xml:"Target"`
+}
+
+func TestHeaderBlockRole(t *testing.T) {
+	for _, tc := range []struct {
+		block HeaderBlock
+		attr  xml.Name
+	}{
+		{HeaderBlock{Content: routing{Target: "a"}, Role: ActorNext},
+			xml.Name{Space: "http://schemas.xmlsoap.org/soap/envelope/", Local: "actor"}},
+		{HeaderBlock{Content: &routing{Target: "a"}, Role: RoleNone, Version: SOAP12},
+			xml.Name{Space: "http://www.w3.org/2003/05/soap-envelope", Local: "role"}},
+		{HeaderBlock{Content: routing{Target: "a"}}, xml.Name{}},
+	} {
+		b, err := xml.Marshal(Envelope{Header: &Header{Content: tc.block}, Version: tc.block.Version})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := xml.NewDecoder(bytes.NewReader(b))
+		var found bool
+		for {
+			token, err := d.Token()
+			if err != nil {
+				break
+			}
+			se, ok := token.(xml.StartElement)
+			if !ok || se.Name != (xml.Name{Space: "urn:esb", Local: "Routing"}) {
+				continue
+			}
+			found = true
+			var role string
+			for _, attr := range se.Attr {
+				if attr.Name == tc.attr {
+					role = attr.Value
+				}
+			}
+			if role != tc.block.Role {
+				t.Errorf("want role %q as %v, got %s", tc.block.Role, tc.attr, b)
+			}
+		}
+		if !found {
+			t.Errorf("want Routing block in\n%s", b)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package soap
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// CallStream SOAP client API call invoking onElement for each child of the
+// response body as it is decoded, so long sequences of records can be
+// processed with bounded memory. onElement must consume the element it is
+// given, e.g. with DecodeElement or Skip; an error it returns stops the
+// stream and is returned. A fault in the body is returned as a *Fault.
+func (s *Client) CallStream(soapAction string, request interface{}, onElement func(*xml.Decoder, xml.StartElement) error) error {
+	ctx := context.Background()
+	return s.withToken(ctx, s.envelope(soapAction, request), func(envelope Envelope) error {
+		return s.stream(ctx, soapAction, envelope, onElement)
+	})
+}
+
+// WithFaultDetailStream decode faults met by CallStream as they are read:
+// onDetail is called with the fault's elements preceding its detail, in
+// practice faultcode and faultstring, and a reader of the detail's
+// character data, so a huge detail such as a stack trace can be truncated
+// without being buffered. The fault's Detail is left empty. An error
+// returned by onDetail stops the call and is returned. Faults carried by an
+// unsuccessful HTTP status are streamed too, and returned as the *HTTPError.
+func WithFaultDetailStream(onDetail func(fault *Fault, detail io.Reader) error) Option {
+	return func(c *Client) {
+		c.faultDetail = onDetail
+	}
+}
+
+// stream send envelope, handing the children of the response body to onElement
+func (s *Client) stream(ctx context.Context, soapAction string, envelope Envelope, onElement func(*xml.Decoder, xml.StartElement) error) error {
+	ctx, cancel := s.withTimeout(ctx, soapAction)
+	defer cancel()
+	ctx, stall := s.withReadWatchdog(ctx)
+	defer stall()
+	res, _, err := s.send(ctx, soapAction, envelope, nil)
+	if err != nil {
+		return err
+	}
+	s.watchBody(res, stall)
+	defer res.Body.Close()
+
+	body, hint, err := s.openBody(res)
+	if err != nil {
+		return err
+	}
+	success := s.isSuccess(res.StatusCode)
+	if !success {
+		if s.faultDetail == nil {
+			return s.statusError(res, body, hint)
+		}
+		onElement = func(d *xml.Decoder, start xml.StartElement) error {
+			return d.Skip()
+		}
+	}
+	err = streamBody(xml.NewDecoder(body), s.faultDetection, s.faultDetail, onElement)
+	if fault, ok := err.(*Fault); ok {
+		s.inspectFault(fault)
+		if !success {
+			return s.mapFault(fault, &HTTPError{StatusCode: res.StatusCode, Header: res.Header, Fault: fault, URL: res.Request.URL.String()})
+		}
+		return s.mapFault(fault, fault)
+	}
+	if err == nil && !success {
+		err = &HTTPError{StatusCode: res.StatusCode, Header: res.Header, URL: res.Request.URL.String()}
+	}
+	return err
+}
+
+// streamBody walk the envelope read by d, handing each body child to
+// onElement and the detail of a fault, when set, to onDetail
+func streamBody(d *xml.Decoder, mode FaultDetection, onDetail func(*Fault, io.Reader) error, onElement func(*xml.Decoder, xml.StartElement) error) error {
+	start, err := nextStart(d)
+	if err != nil {
+		return err
+	}
+	if err = checkEnvelope(start); err != nil {
+		return err
+	}
+	space := start.Name.Space
+	ns := namespaces(nil).with(start.Attr)
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch se := token.(type) {
+		case xml.StartElement:
+			if se.Name.Space == space && se.Name.Local == "Body" {
+				return streamChildren(d, ns.with(se.Attr), space, mode, onDetail, onElement)
+			}
+			if err = d.Skip(); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return xml.UnmarshalError("SOAP envelope has no Body")
+		}
+	}
+}
+
+func streamChildren(d *xml.Decoder, ns namespaces, space string, mode FaultDetection, onDetail func(*Fault, io.Reader) error, onElement func(*xml.Decoder, xml.StartElement) error) error {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch se := token.(type) {
+		case xml.StartElement:
+			if mode.isFault(se.Name, space) {
+				fault := &Fault{envelope: space}
+				if err = fault.decodeWith(d, se, ns, onDetail); err != nil {
+					return err
+				}
+				return fault
+			}
+			if err = onElement(d, se); err != nil {
+				return err
+			}
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+// nextStart return the first start element read by d, failing with
+// ErrDTDNotAllowed on a document type declaration before it
+func nextStart(d *xml.Decoder) (xml.StartElement, error) {
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return xml.StartElement{}, fmt.Errorf("failed to find SOAP envelope: %s", err.Error())
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			return t, nil
+		case xml.Directive:
+			if bytes.HasPrefix(bytes.TrimSpace(t), []byte("DOCTYPE")) {
+				return xml.StartElement{}, ErrDTDNotAllowed
+			}
+		}
+	}
+}
+
+// ErrDTDNotAllowed returned for a response carrying a document type
+// declaration, which SOAP forbids. Rejecting it keeps entity definitions
+// of an untrusted peer, such as an exponential expansion, from being
+// processed at all.
+var ErrDTDNotAllowed = errors.New("SOAP message must not contain a document type declaration")
+
+// checkDTD return ErrDTDNotAllowed when data declares a document type
+func checkDTD(data []byte) error {
+	if _, err := nextStart(xml.NewDecoder(bytes.NewReader(data))); err == ErrDTDNotAllowed {
+		return err
+	}
+	return nil
+}
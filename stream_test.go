@@ -0,0 +1,160 @@
+package soap_test
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/achiku/testsvr"
+	. "github.com/sait/soapc"
+)
+
+type record struct {
+	XMLName xml.Name `xml:"urn:ledger record"`
+	Seq     int      `xml:"seq"`
+}
+
+func recordsResponse(logger testsvr.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		fmt.Fprint(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Header><x/></soap:Header><soap:Body xmlns:l="urn:ledger">`)
+		for i := 0; i < 1000; i++ {
+			fmt.Fprintf(w, "<l:record><seq>%d</seq></l:record>", i)
+			if i%100 == 0 {
+				w.(http.Flusher).Flush()
+			}
+		}
+		fmt.Fprint(w, `</soap:Body></soap:Envelope>`)
+	}
+}
+
+func TestCallStream(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(map[string]testsvr.CreateHandler{
+		"/records": recordsResponse,
+		"/fault":   rawFaultResponse,
+		"/bom":     bomResponse,
+	}, t))
+	defer ts.Close()
+
+	client := NewClient(ts.URL+"/records", false, nil)
+	var n int
+	err := client.CallStream("", testRequest{Message: "test"}, func(d *xml.Decoder, start xml.StartElement) error {
+		var r record
+		if err := d.DecodeElement(&r, &start); err != nil {
+			return err
+		}
+		if r.Seq != n {
+			return fmt.Errorf("want seq %d, got %d", n, r.Seq)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1000 {
+		t.Errorf("want 1000 records, got %d", n)
+	}
+
+	stop := errors.New("stop")
+	err = client.CallStream("", testRequest{Message: "test"}, func(d *xml.Decoder, start xml.StartElement) error {
+		return stop
+	})
+	if err != stop {
+		t.Errorf("want callback error, got %v", err)
+	}
+
+	client = NewClient(ts.URL+"/fault", false, nil)
+	err = client.CallStream("", testRequest{Message: "test"}, func(d *xml.Decoder, start xml.StartElement) error {
+		return d.Skip()
+	})
+	var fault *Fault
+	if !errors.As(err, &fault) {
+		t.Errorf("want fault, got %v", err)
+	}
+
+	var elements []string
+	client = NewClient(ts.URL+"/bom", false, nil)
+	err = client.CallStream("", testRequest{Message: "test"}, func(d *xml.Decoder, start xml.StartElement) error {
+		elements = append(elements, start.Name.Local)
+		return d.Skip()
+	})
+	if err != nil || len(elements) != 1 || elements[0] != "person" {
+		t.Errorf("want person streamed past the BOM, got %v, %v", elements, err)
+	}
+}
+
+func TestCallStreamRejectsDTD(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.Write([]byte(laughsEnvelope))
+	}))
+	defer ts.Close()
+
+	err := NewClient(ts.URL, false, nil).CallStream("", testRequest{Message: "test"}, func(d *xml.Decoder, start xml.StartElement) error {
+		return d.Skip()
+	})
+	if err != ErrDTDNotAllowed {
+		t.Errorf("want ErrDTDNotAllowed, got %v", err)
+	}
+}
+
+func traceFaultResponse(logger testsvr.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprint(w, `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"><soap:Body><soap:Fault><faultcode>soap:Server</faultcode><faultstring>NullPointerException</faultstring><detail><trace>`)
+		for i := 0; i < 10000; i++ {
+			fmt.Fprintf(w, "at com.example.Frame%d(Frame.java:%d)\n", i, i)
+		}
+		fmt.Fprint(w, `</trace></detail></soap:Fault></soap:Body></soap:Envelope>`)
+	}
+}
+
+func TestWithFaultDetailStream(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(map[string]testsvr.CreateHandler{
+		"/trace": traceFaultResponse,
+	}, t))
+	defer ts.Close()
+
+	var code, str, head string
+	client := NewClient(ts.URL+"/trace", false, nil, WithFaultDetailStream(func(fault *Fault, detail io.Reader) error {
+		code, str = fault.Code, fault.String
+		b, err := ioutil.ReadAll(io.LimitReader(detail, 64))
+		head = string(b)
+		return err
+	}))
+	err := client.CallStream("", testRequest{Message: "test"}, func(d *xml.Decoder, start xml.StartElement) error {
+		return d.Skip()
+	})
+	var httpErr *HTTPError
+	if !errors.As(err, &httpErr) || httpErr.Fault == nil {
+		t.Fatalf("want *HTTPError with fault, got %v", err)
+	}
+	if httpErr.Fault.Detail != "" {
+		t.Errorf("want empty detail, got %d bytes", len(httpErr.Fault.Detail))
+	}
+	if code != "soap:Server" || str != "NullPointerException" {
+		t.Errorf("want code and string before detail, got %q %q", code, str)
+	}
+	if len(head) != 64 || !strings.HasPrefix(head, "at com.example.Frame0(") {
+		t.Errorf("want truncated detail, got %q", head)
+	}
+
+	stop := errors.New("stop")
+	client = NewClient(ts.URL+"/trace", false, nil, WithFaultDetailStream(func(fault *Fault, detail io.Reader) error {
+		return stop
+	}))
+	err = client.CallStream("", testRequest{Message: "test"}, func(d *xml.Decoder, start xml.StartElement) error {
+		return d.Skip()
+	})
+	if err != stop {
+		t.Errorf("want callback error, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// WithTimeouts bound each call by the timeout of its SOAPAction in
+// perAction, compared without surrounding quotes and whitespace, or by
+// fallback for the other actions, zero meaning unbounded. The timeout
+// covers sending the request and reading the whole response, retries
+// included. A deadline already set on the context of the call wins.
+// CallMultipart is bounded up to its root part: the attachments, read
+// after the call returns, are not.
+func WithTimeouts(fallback time.Duration, perAction map[string]time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = fallback
+		c.actionTimeouts = make(map[string]time.Duration, len(perAction))
+		for action, timeout := range perAction {
+			c.actionTimeouts[NormalizeSOAPAction(action)] = timeout
+		}
+	}
+}
+
+// withTimeout return ctx bounded by the timeout of soapAction, unless it
+// already has a deadline
+func (s *Client) withTimeout(ctx context.Context, soapAction string) (context.Context, context.CancelFunc) {
+	timeout := s.actionTimeout(soapAction)
+	if _, set := ctx.Deadline(); set || timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+// actionTimeout return the timeout of soapAction, zero when unbounded
+func (s *Client) actionTimeout(soapAction string) time.Duration {
+	timeout, ok := s.actionTimeouts[NormalizeSOAPAction(soapAction)]
+	if !ok {
+		timeout = s.timeout
+	}
+	return timeout
+}
+
+// headTimeout timeout bounding a call until its response is handed over,
+// the rest of the body being read after the call returns
+type headTimeout struct {
+	timer   *time.Timer
+	expired atomic.Bool
+}
+
+// startHeadTimeout call cancel once the timeout of soapAction elapses,
+// unless the returned timeout is stopped first or ctx has a deadline
+func (s *Client) startHeadTimeout(ctx context.Context, soapAction string, cancel context.CancelFunc) *headTimeout {
+	t := &headTimeout{}
+	timeout := s.actionTimeout(soapAction)
+	if _, set := ctx.Deadline(); set || timeout <= 0 {
+		return t
+	}
+	t.timer = time.AfterFunc(timeout, func() {
+		t.expired.Store(true)
+		cancel()
+	})
+	return t
+}
+
+// stop the timeout, reporting false when it elapsed
+func (t *headTimeout) stop() bool {
+	return t.timer == nil || t.timer.Stop()
+}
+
+// ErrReadStalled returned when a response body receives nothing for the
+// timeout set by WithReadIdleTimeout
+var ErrReadStalled = errors.New("SOAP response body read stalled")
+
+// WithReadIdleTimeout fail a call with ErrReadStalled when its response
+// body, once the header has arrived, receives no byte for timeout, e.g.
+// over a half-open connection. Unlike the timeouts of WithTimeouts the
+// watchdog is reset by every read, so a slow but steady body is read to
+// the end however long it takes.
+func WithReadIdleTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.readIdleTimeout = timeout
+	}
+}
+
+// withReadWatchdog return ctx, cancelled by the watchdog of watchBody
+func (s *Client) withReadWatchdog(ctx context.Context) (context.Context, context.CancelFunc) {
+	if s.readIdleTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithCancel(ctx)
+}
+
+// watchBody abort the request of res through cancel when its body stalls
+func (s *Client) watchBody(res *http.Response, cancel context.CancelFunc) {
+	if s.readIdleTimeout <= 0 {
+		return
+	}
+	r := &stallReader{ReadCloser: res.Body, timeout: s.readIdleTimeout}
+	r.timer = time.AfterFunc(s.readIdleTimeout, func() {
+		r.stalled.Store(true)
+		cancel()
+	})
+	res.Body = r
+}
+
+// stallReader body whose timer is reset by every read returning data
+type stallReader struct {
+	io.ReadCloser
+	timeout  time.Duration
+	timer    *time.Timer
+	stalled  atomic.Bool
+	disarmed bool
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 && !r.disarmed {
+		r.timer.Reset(r.timeout)
+	}
+	if err != nil && err != io.EOF && r.stalled.Load() {
+		err = ErrReadStalled
+	}
+	return n, err
+}
+
+// disarm stop watching the body, e.g. once the part of it read within the
+// call has been
+func (r *stallReader) disarm() {
+	r.disarmed = true
+	r.timer.Stop()
+}
+
+func (r *stallReader) Close() error {
+	r.timer.Stop()
+	return r.ReadCloser.Close()
+}
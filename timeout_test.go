@@ -0,0 +1,82 @@
+package soap_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	. "github.com/sait/soapc"
+)
+
+func TestTimeouts(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(50 * time.Millisecond):
+		case <-r.Context().Done():
+			return
+		}
+		w.Write([]byte(personEnvelope))
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, false, nil, WithTimeouts(10*time.Millisecond, map[string]time.Duration{
+		`"urn:Report"`: 5 * time.Second,
+	}))
+	if _, err := client.Call("urn:Lookup", testRequest{Message: "test"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want fallback timeout, got %v", err)
+	}
+	if _, err := client.Call(`"urn:Report"`, testRequest{Message: "test"}); err != nil {
+		t.Errorf("want report within its timeout, got %v", err)
+	}
+	if _, err := client.Call("urn:Report", testRequest{Message: "test"}); err != nil {
+		t.Errorf("want unquoted action matched, got %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := client.CallContext(ctx, "urn:Report", testRequest{Message: "test"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("want the call deadline to win, got %v", err)
+	}
+}
+
+func TestReadIdleTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		// a steady body takes longer than the idle timeout in total
+		pause := 60 * time.Millisecond
+		if r.URL.Path == "/stall" {
+			pause = time.Second
+		}
+		quarter := len(personEnvelope) / 4
+		for i := 0; i < 4; i++ {
+			part := personEnvelope[i*quarter:]
+			if i < 3 {
+				part = part[:quarter]
+			}
+			w.Write([]byte(part))
+			w.(http.Flusher).Flush()
+			select {
+			case <-time.After(pause):
+			case <-r.Context().Done():
+				return
+			}
+		}
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL+"/stall", false, nil, WithReadIdleTimeout(100*time.Millisecond))
+	start := time.Now()
+	if _, err := client.Call("", testRequest{Message: "test"}); !errors.Is(err, ErrReadStalled) {
+		t.Errorf("want ErrReadStalled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("want stall detected early, took %s", elapsed)
+	}
+	client = NewClient(ts.URL+"/steady", false, nil, WithReadIdleTimeout(100*time.Millisecond))
+	if _, err := client.Call("", testRequest{Message: "test"}); err != nil {
+		t.Errorf("want steady body read, got %v", err)
+	}
+}
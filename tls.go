@@ -0,0 +1,137 @@
+package soap
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// WithRootCAs verify server certificates against pool instead of the
+// system roots
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(c *Client) {
+		c.rootCAs = pool
+	}
+}
+
+// WithSkipHostnameVerification verify the server certificate chain against
+// the root CAs but not that the certificate names the host connected to.
+//
+// This is weaker than full verification: any certificate issued by a
+// trusted CA, for any host, is accepted, so a party holding one can
+// impersonate the server. Only use it with a private CA whose certificates
+// are all trusted for this endpoint, e.g. when connecting by an IP address
+// the certificate does not list. It has no effect when the client was
+// created with TLS verification disabled.
+func WithSkipHostnameVerification() Option {
+	return func(c *Client) {
+		c.skipHostnameCheck = true
+	}
+}
+
+// WithVerifyConnection call verify with the state of every new TLS
+// connection, after the standard verification, e.g. to log the presented
+// chain or pin certificates with PinLeafSHA256. An error it returns aborts
+// the connection and fails the call.
+func WithVerifyConnection(verify func(tls.ConnectionState) error) Option {
+	return func(c *Client) {
+		c.verifyConnection = verify
+	}
+}
+
+// WithClientCertificate present the certificate returned by get when a
+// server requests one, chosen per connection from the request, e.g. the
+// CAs the server accepts, so one client can authenticate to partners each
+// expecting its own certificate. See ClientCertificateFor.
+func WithClientCertificate(get func(*tls.CertificateRequestInfo) (*tls.Certificate, error)) Option {
+	return func(c *Client) {
+		c.clientCertificate = get
+	}
+}
+
+// ClientCertificateFor return a WithClientCertificate callback presenting
+// the first of certs the server accepts, by the CAs and signature schemes
+// it advertises, and no certificate when none fits
+func ClientCertificateFor(certs ...tls.Certificate) func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return func(cri *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+		for i := range certs {
+			if cri.SupportsCertificate(&certs[i]) == nil {
+				return &certs[i], nil
+			}
+		}
+		return &tls.Certificate{}, nil
+	}
+}
+
+// CertificateFingerprint return the hex encoded SHA-256 digest of cert
+func CertificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// PinLeafSHA256 return a WithVerifyConnection callback rejecting servers
+// whose leaf certificate fingerprint is not among fingerprints, hex
+// encoded SHA-256 digests in either case, colons allowed
+func PinLeafSHA256(fingerprints ...string) func(tls.ConnectionState) error {
+	pins := make(map[string]bool, len(fingerprints))
+	for _, fp := range fingerprints {
+		pins[strings.ToLower(strings.Replace(fp, ":", "", -1))] = true
+	}
+	return func(state tls.ConnectionState) error {
+		if len(state.PeerCertificates) == 0 {
+			return errors.New("tls: server presented no certificate")
+		}
+		if fp := CertificateFingerprint(state.PeerCertificates[0]); !pins[fp] {
+			return fmt.Errorf("tls: certificate fingerprint %s is not pinned", fp)
+		}
+		return nil
+	}
+}
+
+// tlsConfig return TLS configuration used by every connection of s
+func (s *Client) tlsConfig() *tls.Config {
+	cfg := &tls.Config{
+		InsecureSkipVerify: s.tls,
+		RootCAs:            s.rootCAs,
+	}
+	if s.skipHostnameCheck && !s.tls {
+		// the standard verification always checks the name, so it is
+		// disabled and the chain verified by the callback instead
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = verifyChain(s.rootCAs)
+	}
+	cfg.VerifyConnection = s.verifyConnection
+	cfg.GetClientCertificate = s.clientCertificate
+	return cfg
+}
+
+// verifyChain return a callback verifying the presented chain against roots,
+// the system roots when nil, without checking the server name
+func verifyChain(roots *x509.CertPool) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return errors.New("tls: server presented no certificate")
+		}
+		certs := make([]*x509.Certificate, len(rawCerts))
+		for i, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				return err
+			}
+			certs[i] = cert
+		}
+		opts := x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: x509.NewCertPool(),
+		}
+		for _, cert := range certs[1:] {
+			opts.Intermediates.AddCert(cert)
+		}
+		_, err := certs[0].Verify(opts)
+		return err
+	}
+}
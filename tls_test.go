@@ -0,0 +1,192 @@
+package soap_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/sait/soapc"
+)
+
+func newTLSServer(t *testing.T) (*httptest.Server, *x509.CertPool) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(personEnvelope))
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+	return ts, pool
+}
+
+func TestSkipHostnameVerification(t *testing.T) {
+	ts, pool := newTLSServer(t)
+	defer ts.Close()
+
+	// the test certificate is issued for 127.0.0.1 and example.com only
+	url := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+	req := testRequest{Message: "test"}
+
+	client := NewClient(url, false, nil, WithRootCAs(pool))
+	if _, err := client.Call("", req); err == nil {
+		t.Fatal("want hostname mismatch error")
+	}
+
+	client = NewClient(url, false, nil, WithRootCAs(pool), WithSkipHostnameVerification())
+	if _, err := client.Call("", req); err != nil {
+		t.Fatal(err)
+	}
+
+	client = NewClient(url, false, nil, WithSkipHostnameVerification())
+	if _, err := client.Call("", req); err == nil {
+		t.Fatal("want unknown authority error")
+	}
+}
+
+func TestCallFullTLSState(t *testing.T) {
+	ts, pool := newTLSServer(t)
+	defer ts.Close()
+
+	client := NewClient(ts.URL, false, nil, WithRootCAs(pool))
+	res, err := client.CallFull("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TLS == nil {
+		t.Fatal("want TLS connection state")
+	}
+	if res.TLS.Version < tls.VersionTLS12 {
+		t.Errorf("want TLS 1.2+, got %s", tls.VersionName(res.TLS.Version))
+	}
+	if res.TLS.CipherSuite == 0 || len(res.TLS.PeerCertificates) == 0 {
+		t.Errorf("want cipher suite and peer certificates, got %+v", res.TLS)
+	}
+	t.Logf("%s %s", tls.VersionName(res.TLS.Version), tls.CipherSuiteName(res.TLS.CipherSuite))
+
+	plain := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(personEnvelope))
+	}))
+	defer plain.Close()
+	res, err = NewClient(plain.URL, false, nil).CallFull("", testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TLS != nil {
+		t.Errorf("want no TLS state over plain HTTP, got %+v", res.TLS)
+	}
+	if res.StatusCode != http.StatusOK || string(res.Body) != personEnvelope {
+		t.Errorf("unexpected response %d %s", res.StatusCode, res.Body)
+	}
+}
+
+func TestVerifyConnectionPinning(t *testing.T) {
+	ts, pool := newTLSServer(t)
+	defer ts.Close()
+	req := testRequest{Message: "test"}
+
+	var seen []string
+	logger := func(state tls.ConnectionState) error {
+		seen = append(seen, CertificateFingerprint(state.PeerCertificates[0]))
+		return nil
+	}
+	client := NewClient(ts.URL, false, nil, WithRootCAs(pool), WithVerifyConnection(logger))
+	if _, err := client.Call("", req); err != nil {
+		t.Fatal(err)
+	}
+	leaf := CertificateFingerprint(ts.Certificate())
+	if len(seen) != 1 || seen[0] != leaf {
+		t.Fatalf("want leaf fingerprint %s logged, got %v", leaf, seen)
+	}
+
+	colons := strings.ToUpper(leaf[:2]) + ":" + leaf[2:]
+	client = NewClient(ts.URL, false, nil, WithRootCAs(pool), WithVerifyConnection(PinLeafSHA256("00", colons)))
+	if _, err := client.Call("", req); err != nil {
+		t.Fatal(err)
+	}
+	client = NewClient(ts.URL, false, nil, WithRootCAs(pool), WithVerifyConnection(PinLeafSHA256(strings.Repeat("00", 32))))
+	if _, err := client.Call("", req); err == nil || !strings.Contains(err.Error(), "not pinned") {
+		t.Errorf("want pinning failure, got %v", err)
+	}
+}
+
+// newClientCA return a CA pool and a client certificate it issued for cn
+func newClientCA(t *testing.T, cn string) (*x509.CertPool, tls.Certificate) {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn + " CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return pool, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestClientCertificatePerServer(t *testing.T) {
+	partnerCAs, partnerCert := newClientCA(t, "partner")
+	_, otherCert := newClientCA(t, "other")
+
+	var presented string
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented = r.TLS.PeerCertificates[0].Subject.CommonName
+		w.Write([]byte(personEnvelope))
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: partnerCAs}
+	ts.StartTLS()
+	defer ts.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(ts.Certificate())
+
+	client := NewClient(ts.URL, false, nil, WithRootCAs(pool),
+		WithClientCertificate(ClientCertificateFor(otherCert, partnerCert)))
+	if _, err := client.Call("", testRequest{Message: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	if presented != "partner" {
+		t.Errorf("want partner certificate presented, got %q", presented)
+	}
+
+	client = NewClient(ts.URL, false, nil, WithRootCAs(pool),
+		WithClientCertificate(ClientCertificateFor(otherCert)))
+	if _, err := client.Call("", testRequest{Message: "test"}); err == nil {
+		t.Error("want handshake failure without an accepted certificate")
+	}
+}
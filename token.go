@@ -0,0 +1,127 @@
+package soap
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// TokenProvider obtain the SOAP header block carrying a fresh credential,
+// such as a bearer token issued by an STS, along with its expiry. A zero
+// expiry keeps the block until the service rejects it.
+type TokenProvider func(ctx context.Context) (header interface{}, expires time.Time, err error)
+
+// WithTokenProvider add the header block of provider to every call. The
+// block is cached until it expires; when a call fails authentication, as
+// told by isAuthFault, the block is refreshed and the call retried once.
+// A nil isAuthFault recognizes HTTP 401 responses and the WS-Security
+// FailedAuthentication, InvalidSecurityToken and SecurityTokenUnavailable
+// faults.
+func WithTokenProvider(provider TokenProvider, isAuthFault func(*Fault) bool) Option {
+	return func(c *Client) {
+		if isAuthFault == nil {
+			isAuthFault = isSecurityFault
+		}
+		c.tokens = &tokenCache{provider: provider, isAuthFault: isAuthFault}
+	}
+}
+
+// isSecurityFault report whether fault is a WS-Security authentication fault
+func isSecurityFault(fault *Fault) bool {
+	switch fault.CodeName.Local {
+	case "FailedAuthentication", "InvalidSecurityToken", "SecurityTokenUnavailable":
+		return true
+	}
+	return false
+}
+
+// tokenCache header block of a TokenProvider, cached until it expires
+type tokenCache struct {
+	provider    TokenProvider
+	isAuthFault func(*Fault) bool
+
+	mu         sync.Mutex
+	header     interface{}
+	expires    time.Time
+	generation int
+}
+
+// get return the cached header block, obtaining a new one when there is
+// none or it expired, along with its generation
+func (t *tokenCache) get(ctx context.Context) (interface{}, int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.header != nil && (t.expires.IsZero() || time.Now().Before(t.expires)) {
+		return t.header, t.generation, nil
+	}
+	header, expires, err := t.provider(ctx)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to obtain token: %w", err)
+	}
+	t.header, t.expires = header, expires
+	t.generation++
+	return t.header, t.generation, nil
+}
+
+// invalidate drop the header block of generation, unless already replaced
+func (t *tokenCache) invalidate(generation int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.generation == generation {
+		t.header = nil
+	}
+}
+
+// isAuthFailure report whether err is a call failing authentication
+func (t *tokenCache) isAuthFailure(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) && httpErr.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+	var fault *Fault
+	return errors.As(err, &fault) && t.isAuthFault(fault)
+}
+
+// withToken run call with envelope carrying the token header block, once
+// more with a refreshed block if it fails authentication
+func (s *Client) withToken(ctx context.Context, envelope Envelope, call func(Envelope) error) error {
+	if s.tokens == nil {
+		return call(envelope)
+	}
+	header, generation, err := s.tokens.get(ctx)
+	if err != nil {
+		return err
+	}
+	err = call(addHeaderBlock(envelope, header))
+	if err == nil || !s.tokens.isAuthFailure(err) {
+		return err
+	}
+	s.tokens.invalidate(generation)
+	if header, _, err = s.tokens.get(ctx); err != nil {
+		return err
+	}
+	return call(addHeaderBlock(envelope, header))
+}
+
+// addHeaderBlock return envelope with block prepended to its header blocks
+func addHeaderBlock(envelope Envelope, block interface{}) Envelope {
+	blocks := []interface{}{block}
+	var raw []byte
+	if envelope.Header != nil {
+		raw = envelope.Header.Raw
+		if content, ok := envelope.Header.Content.([]interface{}); ok {
+			blocks = append(blocks, content...)
+		} else if envelope.Header.Content != nil {
+			blocks = append(blocks, envelope.Header.Content)
+		}
+	}
+	if len(blocks) == 1 {
+		envelope.Header = &Header{Content: block, Raw: raw}
+	} else {
+		envelope.Header = &Header{Content: blocks, Raw: raw}
+	}
+	return envelope
+}
@@ -0,0 +1,90 @@
+package soap_test
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/sait/soapc"
+)
+
+type bearerHeader struct {
+	XMLName xml.Name `xml:"urn:sts Token"`
+	Value   string   `xml:",chardata"`
+}
+
+const securityFaultEnvelope = `<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/"
+    xmlns:wsse="http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd">
+  <soap:Body><soap:Fault><faultcode>wsse:InvalidSecurityToken</faultcode><faultstring>expired</faultstring></soap:Fault></soap:Body>
+</soap:Envelope>`
+
+func TestTokenProvider(t *testing.T) {
+	valid := "token-2"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if !strings.Contains(string(b), ">"+valid+"</Token>") {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(securityFaultEnvelope))
+			return
+		}
+		w.Write([]byte(personEnvelope))
+	}))
+	defer ts.Close()
+
+	var issued int
+	provider := func(ctx context.Context) (interface{}, time.Time, error) {
+		issued++
+		return bearerHeader{Value: fmt.Sprintf("token-%d", issued)}, time.Now().Add(time.Hour), nil
+	}
+	client := NewClient(ts.URL, false, myRequestHeader{UserID: "myname"}, WithTokenProvider(provider, nil))
+	req := testRequest{Message: "test"}
+
+	if _, err := client.Call("", req); err != nil {
+		t.Fatal(err)
+	}
+	if issued != 2 {
+		t.Errorf("want token refreshed once after the auth fault, issued %d", issued)
+	}
+	if _, err := client.Call("", req); err != nil {
+		t.Fatal(err)
+	}
+	if issued != 2 {
+		t.Errorf("want cached token reused, issued %d", issued)
+	}
+
+	valid = "never"
+	if _, err := client.Call("", req); err == nil {
+		t.Error("want auth fault after the single retry")
+	}
+	if issued != 3 {
+		t.Errorf("want a single retry, issued %d", issued)
+	}
+}
+
+func TestTokenProviderExpiry(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(personEnvelope))
+	}))
+	defer ts.Close()
+
+	var issued int
+	provider := func(ctx context.Context) (interface{}, time.Time, error) {
+		issued++
+		return bearerHeader{Value: "token"}, time.Now().Add(-time.Second), nil
+	}
+	client := NewClient(ts.URL, false, nil, WithTokenProvider(provider, nil))
+	for i := 0; i < 2; i++ {
+		if _, err := client.Call("", testRequest{Message: "test"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if issued != 2 {
+		t.Errorf("want expired token refreshed on each call, issued %d", issued)
+	}
+}
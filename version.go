@@ -0,0 +1,49 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+)
+
+// SOAPVersion SOAP protocol version of an envelope
+type SOAPVersion int
+
+// SOAPVersion values
+const (
+	SOAP11 SOAPVersion = iota + 1
+	SOAP12
+)
+
+func (v SOAPVersion) String() string {
+	switch v {
+	case SOAP11:
+		return "1.1"
+	case SOAP12:
+		return "1.2"
+	}
+	return fmt.Sprintf("SOAPVersion(%d)", int(v))
+}
+
+// EnvelopeVersion return the SOAP version of the envelope in data, told by
+// the namespace of its root element
+func EnvelopeVersion(data []byte) (SOAPVersion, error) {
+	start, err := nextStart(xml.NewDecoder(bytes.NewReader(data)))
+	if err != nil {
+		return 0, err
+	}
+	if start.Name.Local == "Envelope" {
+		switch start.Name.Space {
+		case envelopeNamespace:
+			return SOAP11, nil
+		case envelope12Namespace:
+			return SOAP12, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown SOAP envelope {%s}%s", start.Name.Space, start.Name.Local)
+}
+
+// Version return the SOAP version of the response envelope
+func (r *Response) Version() (SOAPVersion, error) {
+	return EnvelopeVersion(r.Body)
+}
@@ -0,0 +1,94 @@
+package soap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// wsdlDefinitions the parts of a WSDL 1.1 document configuring a client
+type wsdlDefinitions struct {
+	Services []wsdlService `xml:"http://schemas.xmlsoap.org/wsdl/ service"`
+	Bindings []wsdlBinding `xml:"http://schemas.xmlsoap.org/wsdl/ binding"`
+}
+
+type wsdlService struct {
+	Name  string     `xml:"name,attr"`
+	Ports []wsdlPort `xml:"http://schemas.xmlsoap.org/wsdl/ port"`
+}
+
+type wsdlPort struct {
+	Name    string `xml:"name,attr"`
+	Binding string `xml:"binding,attr"`
+	Address *struct {
+		Location string `xml:"location,attr"`
+	} `xml:"http://schemas.xmlsoap.org/wsdl/soap/ address"`
+}
+
+type wsdlBinding struct {
+	Name       string          `xml:"name,attr"`
+	Operations []wsdlOperation `xml:"http://schemas.xmlsoap.org/wsdl/ operation"`
+}
+
+type wsdlOperation struct {
+	Name string `xml:"name,attr"`
+	SOAP *struct {
+		Action string `xml:"soapAction,attr"`
+	} `xml:"http://schemas.xmlsoap.org/wsdl/soap/ operation"`
+}
+
+// NewClientFromWSDL return a client of the endpoint of port portName of
+// service serviceName in the WSDL 1.1 document wsdl, configured with opts,
+// along with the SOAPAction of each operation of the port's binding, keyed
+// by operation name. The port must have a SOAP 1.1 address. Documents
+// imported by wsdl are not read: the service and its binding must be
+// defined in wsdl itself.
+func NewClientFromWSDL(wsdl io.Reader, serviceName, portName string, opts ...Option) (*Client, map[string]string, error) {
+	var definitions wsdlDefinitions
+	if err := xml.NewDecoder(wsdl).Decode(&definitions); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse WSDL: %s", err.Error())
+	}
+	var service *wsdlService
+	for i := range definitions.Services {
+		if definitions.Services[i].Name == serviceName {
+			service = &definitions.Services[i]
+			break
+		}
+	}
+	if service == nil {
+		return nil, nil, fmt.Errorf("WSDL has no service %q", serviceName)
+	}
+	var port *wsdlPort
+	for i := range service.Ports {
+		if service.Ports[i].Name == portName {
+			port = &service.Ports[i]
+			break
+		}
+	}
+	if port == nil {
+		return nil, nil, fmt.Errorf("WSDL service %q has no port %q", serviceName, portName)
+	}
+	if port.Address == nil || port.Address.Location == "" {
+		return nil, nil, fmt.Errorf("WSDL port %q has no SOAP 1.1 address", portName)
+	}
+	// the binding is referenced by a QName, its prefix being the target
+	// namespace of the document
+	binding := port.Binding
+	if i := strings.LastIndex(binding, ":"); i >= 0 {
+		binding = binding[i+1:]
+	}
+	for _, b := range definitions.Bindings {
+		if b.Name != binding {
+			continue
+		}
+		actions := make(map[string]string, len(b.Operations))
+		for _, op := range b.Operations {
+			if op.SOAP != nil {
+				actions[op.Name] = op.SOAP.Action
+			}
+		}
+		return NewClient(port.Address.Location, false, nil, opts...), actions, nil
+	}
+	return nil, nil, fmt.Errorf("WSDL has no binding %q for port %q", port.Binding, portName)
+}
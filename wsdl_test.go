@@ -0,0 +1,60 @@
+package soap_test
+
+import (
+	"strings"
+	"testing"
+
+	. "github.com/sait/soapc"
+)
+
+const ordersWSDL = `<?xml version="1.0" encoding="UTF-8"?>
+<wsdl:definitions xmlns:wsdl="http://schemas.xmlsoap.org/wsdl/" xmlns:soap="http://schemas.xmlsoap.org/wsdl/soap/"
+    xmlns:soap12="http://schemas.xmlsoap.org/wsdl/soap12/" xmlns:tns="http://example.com/orders" targetNamespace="http://example.com/orders">
+  <wsdl:binding name="OrdersBinding" type="tns:OrdersPortType">
+    <soap:binding transport="http://schemas.xmlsoap.org/soap/http"/>
+    <wsdl:operation name="GetOrder">
+      <soap:operation soapAction="http://example.com/orders/GetOrder"/>
+    </wsdl:operation>
+    <wsdl:operation name="CancelOrder">
+      <soap:operation soapAction="http://example.com/orders/CancelOrder"/>
+    </wsdl:operation>
+  </wsdl:binding>
+  <wsdl:binding name="OrdersBinding12" type="tns:OrdersPortType">
+    <soap12:binding transport="http://schemas.xmlsoap.org/soap/http"/>
+  </wsdl:binding>
+  <wsdl:service name="Orders">
+    <wsdl:port name="OrdersPort" binding="tns:OrdersBinding">
+      <soap:address location="https://orders.example.com/soap"/>
+    </wsdl:port>
+    <wsdl:port name="OrdersPort12" binding="tns:OrdersBinding12">
+      <soap12:address location="https://orders.example.com/soap12"/>
+    </wsdl:port>
+  </wsdl:service>
+</wsdl:definitions>`
+
+func TestNewClientFromWSDL(t *testing.T) {
+	client, actions, err := NewClientFromWSDL(strings.NewReader(ordersWSDL), "Orders", "OrdersPort", WithHeaders(map[string]string{"User-Agent": "orders"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 2 || actions["GetOrder"] != "http://example.com/orders/GetOrder" {
+		t.Errorf("unexpected actions %v", actions)
+	}
+	req, err := client.DryRun(actions["CancelOrder"], testRequest{Message: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.URL.String() != "https://orders.example.com/soap" || req.Header.Get("User-Agent") != "orders" {
+		t.Errorf("unexpected request to %s by %s", req.URL, req.Header.Get("User-Agent"))
+	}
+
+	for _, tc := range []struct{ service, port, want string }{
+		{"Billing", "OrdersPort", `no service "Billing"`},
+		{"Orders", "Missing", `no port "Missing"`},
+		{"Orders", "OrdersPort12", "no SOAP 1.1 address"},
+	} {
+		if _, _, err := NewClientFromWSDL(strings.NewReader(ordersWSDL), tc.service, tc.port); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s/%s: want error %q, got %v", tc.service, tc.port, tc.want, err)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package soap
+
+import (
+	"crypto/rand"
+	"encoding/xml"
+	"fmt"
+	"sync"
+)
+
+// WSRMNamespace WS-ReliableMessaging 1.1 namespace
+const WSRMNamespace = "http://docs.oasis-open.org/ws-rx/wsrm/200702"
+
+// RMSequence wsrm:Sequence header block
+type RMSequence struct {
+	XMLName        xml.Name `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 Sequence"`
+	MustUnderstand string   `xml:"http://schemas.xmlsoap.org/soap/envelope/ mustUnderstand,attr,omitempty"`
+	Identifier     string   `xml:"Identifier"`
+	MessageNumber  uint64   `xml:"MessageNumber"`
+}
+
+// RMAckRequested wsrm:AckRequested header block
+type RMAckRequested struct {
+	XMLName    xml.Name `xml:"http://docs.oasis-open.org/ws-rx/wsrm/200702 AckRequested"`
+	Identifier string   `xml:"Identifier"`
+}
+
+// ReliableSequence WS-ReliableMessaging sequence numbering the messages
+// sent within it. It is safe for concurrent use; concurrent calls are
+// numbered in the order they build their envelope.
+type ReliableSequence struct {
+	mu           sync.Mutex
+	identifier   string
+	last         uint64
+	ackRequested bool
+}
+
+// NewReliableSequence return sequence identified by identifier, usually
+// the one granted by the destination's CreateSequenceResponse. An empty
+// identifier generates a urn:uuid one.
+func NewReliableSequence(identifier string, ackRequested bool) (*ReliableSequence, error) {
+	if identifier == "" {
+		var err error
+		if identifier, err = newUUIDURN(); err != nil {
+			return nil, fmt.Errorf("failed to generate sequence identifier: %s", err.Error())
+		}
+	}
+	return &ReliableSequence{
+		identifier:   identifier,
+		ackRequested: ackRequested,
+	}, nil
+}
+
+// Identifier return the sequence identifier
+func (r *ReliableSequence) Identifier() string {
+	return r.identifier
+}
+
+// MessageNumber return the number of the last message sent, 0 if none
+func (r *ReliableSequence) MessageNumber() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.last
+}
+
+// Next return the header blocks for the next message of the sequence,
+// numbering it
+func (r *ReliableSequence) Next() []interface{} {
+	r.mu.Lock()
+	r.last++
+	n := r.last
+	r.mu.Unlock()
+	return r.blocks(n)
+}
+
+// peek return the header blocks Next would, without numbering the message
+func (r *ReliableSequence) peek() []interface{} {
+	return r.blocks(r.MessageNumber() + 1)
+}
+
+func (r *ReliableSequence) blocks(n uint64) []interface{} {
+	blocks := []interface{}{
+		RMSequence{
+			MustUnderstand: "1",
+			Identifier:     r.identifier,
+			MessageNumber:  n,
+		},
+	}
+	if r.ackRequested {
+		blocks = append(blocks, RMAckRequested{Identifier: r.identifier})
+	}
+	return blocks
+}
+
+// WithReliableSequence add the WS-ReliableMessaging header blocks of seq to
+// every call, numbering each call as the next message of the sequence
+func WithReliableSequence(seq *ReliableSequence) Option {
+	return func(c *Client) {
+		c.reliable = seq
+	}
+}
+
+// newUUIDURN return a random (version 4) UUID URN
+func newUUIDURN() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", err
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("urn:uuid:%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:]), nil
+}
@@ -0,0 +1,54 @@
+package soap_test
+
+import (
+	"encoding/xml"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/achiku/testsvr"
+	. "github.com/sait/soapc"
+)
+
+func TestReliableSequence(t *testing.T) {
+	ts := httptest.NewServer(testsvr.NewMux(DefaultHandlerMap, t))
+	defer ts.Close()
+
+	seq, err := NewReliableSequence("", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(seq.Identifier(), "urn:uuid:") {
+		t.Errorf("want urn:uuid identifier, got %s", seq.Identifier())
+	}
+	header := myRequestHeader{UserID: "myname", Password: "pass"}
+	client := NewClient(ts.URL+"/echo", false, header, WithReliableSequence(seq))
+
+	for i := uint64(1); i <= 3; i++ {
+		resp, err := client.Call("", testRequest{Message: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sent RMSequence
+		env := Envelope{
+			Header: &Header{Content: &sent},
+			Body:   Body{Content: &struct{}{}},
+		}
+		if err := xml.Unmarshal(resp, &env); err != nil {
+			t.Fatal(err)
+		}
+		if sent.Identifier != seq.Identifier() || sent.MessageNumber != i || sent.MustUnderstand != "1" {
+			t.Errorf("message %d: unexpected sequence block %+v", i, sent)
+		}
+		var names []string
+		for _, block := range env.Header.Unknown {
+			names = append(names, block.XMLName.Local)
+		}
+		if strings.Join(names, ",") != "myRequestHeader,AckRequested" {
+			t.Errorf("want user header and AckRequested kept, got %v", names)
+		}
+	}
+	if n := seq.MessageNumber(); n != 3 {
+		t.Errorf("want last message number 3, got %d", n)
+	}
+}
@@ -0,0 +1,36 @@
+package soap
+
+import (
+	"encoding/base64"
+	"encoding/xml"
+	"testing"
+	"time"
+)
+
+func TestUsernameTokenDigestWire(t *testing.T) {
+	nonce := []byte("0123456789abcdef")
+	created := time.Date(2010, 9, 16, 9, 50, 45, 123456789, time.FixedZone("CEST", 2*60*60))
+	b, err := xml.Marshal(usernameTokenDigest("user", "userpassword", nonce, created))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sent Security
+	if err := xml.Unmarshal(b, &sent); err != nil {
+		t.Fatal(err)
+	}
+	token := sent.UsernameToken
+	if token.Created != "2010-09-16T07:50:45Z" {
+		t.Errorf("want created in UTC without fraction, got %q", token.Created)
+	}
+	wireNonce, err := base64.StdEncoding.DecodeString(token.Nonce.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Password.Type != PasswordDigestType || token.Nonce.EncodingType != Base64BinaryType {
+		t.Errorf("unexpected token types %+v", token)
+	}
+	if want := PasswordDigest(wireNonce, token.Created, "userpassword"); token.Password.Value != want {
+		t.Errorf("digest does not match the wire values: want %s, got %s\n%s", want, token.Password.Value, b)
+	}
+}
@@ -0,0 +1,56 @@
+package soap_test
+
+import (
+	"encoding/base64"
+	"testing"
+
+	. "github.com/sait/soapc"
+)
+
+func TestPasswordDigest(t *testing.T) {
+	cases := []struct {
+		nonce    string
+		created  string
+		password string
+		expected string
+	}{
+		{
+			nonce:    "LKqI6G/AikKCQrN0zqZFlg==",
+			created:  "2010-09-16T07:50:45Z",
+			password: "userpassword",
+			expected: "tuOSpGlFlIXsozq4HFNeeGeFLEI=",
+		},
+		{
+			nonce:    "WScqanjCEAC4mQoBE07sAQ==",
+			created:  "2003-07-16T01:24:32Z",
+			password: "password",
+			expected: "35G+fVLJOPu0MSJRj20Be9HMkuQ=",
+		},
+	}
+	for _, c := range cases {
+		nonce, err := base64.StdEncoding.DecodeString(c.nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := PasswordDigest(nonce, c.created, c.password); got != c.expected {
+			t.Errorf("want %s, got %s", c.expected, got)
+		}
+	}
+}
+
+func TestNewUsernameTokenDigest(t *testing.T) {
+	a, err := NewUsernameTokenDigest("user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewUsernameTokenDigest("user", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.UsernameToken.Nonce.Value == b.UsernameToken.Nonce.Value {
+		t.Error("want a fresh nonce for each token")
+	}
+	if a.UsernameToken.Password.Value == "secret" {
+		t.Error("want the password digested, not sent")
+	}
+}
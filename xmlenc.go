@@ -0,0 +1,375 @@
+package soap
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// XML Encryption namespaces and algorithm URIs
+const (
+	XMLEncNamespace = "http://www.w3.org/2001/04/xmlenc#"
+	DSigNamespace   = "http://www.w3.org/2000/09/xmldsig#"
+
+	AES128CBC = "http://www.w3.org/2001/04/xmlenc#aes128-cbc"
+	AES256CBC = "http://www.w3.org/2001/04/xmlenc#aes256-cbc"
+	AES128GCM = "http://www.w3.org/2009/xmlenc11#aes128-gcm"
+	AES256GCM = "http://www.w3.org/2009/xmlenc11#aes256-gcm"
+	RSAOAEP   = "http://www.w3.org/2001/04/xmlenc#rsa-oaep-mgf1p"
+
+	EncryptedContentType = "http://www.w3.org/2001/04/xmlenc#Content"
+	ThumbprintSHA1Type   = "http://docs.oasis-open.org/wss/oasis-wss-soap-message-security-1.1#ThumbprintSHA1"
+)
+
+// EncryptedData xenc:EncryptedData replacing the encrypted body content
+type EncryptedData struct {
+	XMLName          xml.Name `xml:"http://www.w3.org/2001/04/xmlenc# EncryptedData"`
+	ID               string   `xml:"Id,attr,omitempty"`
+	Type             string   `xml:"Type,attr,omitempty"`
+	EncryptionMethod EncryptionMethod
+	CipherData       CipherData
+}
+
+// EncryptedKey xenc:EncryptedKey carrying the session key of the
+// EncryptedData it references, wrapped for the recipient
+type EncryptedKey struct {
+	XMLName          xml.Name `xml:"http://www.w3.org/2001/04/xmlenc# EncryptedKey"`
+	EncryptionMethod EncryptionMethod
+	KeyInfo          *KeyInfo `xml:",omitempty"`
+	CipherData       CipherData
+	ReferenceList    *ReferenceList `xml:",omitempty"`
+}
+
+// EncryptionMethod algorithm of an EncryptedData or EncryptedKey
+type EncryptionMethod struct {
+	XMLName   xml.Name `xml:"http://www.w3.org/2001/04/xmlenc# EncryptionMethod"`
+	Algorithm string   `xml:"Algorithm,attr"`
+}
+
+// CipherData encrypted octets
+type CipherData struct {
+	XMLName     xml.Name     `xml:"http://www.w3.org/2001/04/xmlenc# CipherData"`
+	CipherValue Base64Binary `xml:"http://www.w3.org/2001/04/xmlenc# CipherValue"`
+}
+
+// ReferenceList EncryptedData elements encrypted with an EncryptedKey
+type ReferenceList struct {
+	XMLName        xml.Name        `xml:"http://www.w3.org/2001/04/xmlenc# ReferenceList"`
+	DataReferences []DataReference `xml:"http://www.w3.org/2001/04/xmlenc# DataReference"`
+}
+
+// DataReference reference to an EncryptedData by its Id, e.g. "#ED-1"
+type DataReference struct {
+	URI string `xml:"URI,attr"`
+}
+
+// KeyInfo ds:KeyInfo identifying the key an EncryptedKey is wrapped with
+type KeyInfo struct {
+	XMLName                xml.Name                `xml:"http://www.w3.org/2000/09/xmldsig# KeyInfo"`
+	SecurityTokenReference *SecurityTokenReference `xml:",omitempty"`
+}
+
+// SecurityTokenReference wsse:SecurityTokenReference
+type SecurityTokenReference struct {
+	XMLName       xml.Name       `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd SecurityTokenReference"`
+	KeyIdentifier *KeyIdentifier `xml:",omitempty"`
+}
+
+// KeyIdentifier wsse:KeyIdentifier, e.g. the SHA-1 thumbprint of a
+// certificate
+type KeyIdentifier struct {
+	XMLName      xml.Name `xml:"http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd KeyIdentifier"`
+	ValueType    string   `xml:"ValueType,attr,omitempty"`
+	EncodingType string   `xml:"EncodingType,attr,omitempty"`
+	Value        string   `xml:",chardata"`
+}
+
+// BodyEncryption XML Encryption of request and response bodies
+type BodyEncryption struct {
+	// Recipient certificate whose RSA key wraps the session key of
+	// requests, nil to send requests in the clear and only decrypt
+	// responses
+	Recipient *x509.Certificate
+	// Key RSA key unwrapping the session key of encrypted responses, nil
+	// to return responses as received
+	Key *rsa.PrivateKey
+	// Algorithm data encryption algorithm of requests, AES256CBC when
+	// empty
+	Algorithm string
+}
+
+// WithBodyEncryption encrypt the body content of every request with
+// EncryptBody, and decrypt encrypted responses with DecryptBody, so that
+// the response returned by calls is the plain envelope. Responses without
+// EncryptedData, such as faults of a server failing to decrypt, are
+// returned as received. CallStream decodes the response as received.
+func WithBodyEncryption(enc BodyEncryption) Option {
+	return func(c *Client) {
+		c.encryption = &enc
+	}
+}
+
+// EncryptBody return envelope with its body content encrypted for
+// recipient with a fresh session key: the content is replaced by an
+// EncryptedData, and the key, wrapped under the RSA key of recipient with
+// RSA-OAEP, added as an EncryptedKey to the wsse:Security header block,
+// which is created when envelope has none. algorithm is one of AES128CBC,
+// AES256CBC, AES128GCM and AES256GCM, AES256CBC when empty.
+func EncryptBody(envelope Envelope, recipient *x509.Certificate, algorithm string) (Envelope, error) {
+	if algorithm == "" {
+		algorithm = AES256CBC
+	}
+	if recipient == nil {
+		return envelope, errors.New("failed to encrypt SOAP body: no recipient certificate")
+	}
+	pub, ok := recipient.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return envelope, errors.New("failed to encrypt SOAP body: recipient key is not RSA")
+	}
+	size, err := keySize(algorithm)
+	if err != nil {
+		return envelope, err
+	}
+	plaintext, err := xml.Marshal(envelope.Body.Content)
+	if err != nil {
+		return envelope, fmt.Errorf("failed to encode SOAP body: %s", err.Error())
+	}
+	key := make([]byte, size)
+	id := make([]byte, 8)
+	if _, err = io.ReadFull(rand.Reader, key); err == nil {
+		_, err = io.ReadFull(rand.Reader, id)
+	}
+	if err != nil {
+		return envelope, err
+	}
+	ciphertext, err := encryptData(algorithm, key, plaintext)
+	if err != nil {
+		return envelope, err
+	}
+	wrapped, err := rsa.EncryptOAEP(sha1.New(), rand.Reader, pub, key, nil)
+	if err != nil {
+		return envelope, fmt.Errorf("failed to wrap session key: %s", err.Error())
+	}
+	data := &EncryptedData{
+		ID:               "ED-" + hex.EncodeToString(id),
+		Type:             EncryptedContentType,
+		EncryptionMethod: EncryptionMethod{Algorithm: algorithm},
+		CipherData:       CipherData{CipherValue: ciphertext},
+	}
+	thumbprint := sha1.Sum(recipient.Raw)
+	encryptedKey := &EncryptedKey{
+		EncryptionMethod: EncryptionMethod{Algorithm: RSAOAEP},
+		KeyInfo: &KeyInfo{SecurityTokenReference: &SecurityTokenReference{KeyIdentifier: &KeyIdentifier{
+			ValueType:    ThumbprintSHA1Type,
+			EncodingType: Base64BinaryType,
+			Value:        base64.StdEncoding.EncodeToString(thumbprint[:]),
+		}}},
+		CipherData:    CipherData{CipherValue: wrapped},
+		ReferenceList: &ReferenceList{DataReferences: []DataReference{{URI: "#" + data.ID}}},
+	}
+	envelope.Body.Content = data
+	return withEncryptedKey(envelope, encryptedKey), nil
+}
+
+// withEncryptedKey return envelope with key added to its Security header
+// block, envelope's own header left untouched
+func withEncryptedKey(envelope Envelope, key *EncryptedKey) Envelope {
+	header := &Header{}
+	if envelope.Header != nil {
+		*header = *envelope.Header
+	}
+	var blocks []interface{}
+	switch content := header.Content.(type) {
+	case nil:
+	case []interface{}:
+		blocks = append(blocks, content...)
+	default:
+		blocks = append(blocks, content)
+	}
+	merged := false
+	for i, block := range blocks {
+		var security Security
+		switch b := block.(type) {
+		case *Security:
+			security = *b
+		case Security:
+			security = b
+		default:
+			continue
+		}
+		security.EncryptedKey = key
+		blocks[i] = &security
+		merged = true
+		break
+	}
+	if !merged {
+		blocks = append([]interface{}{&Security{MustUnderstand: "1", EncryptedKey: key}}, blocks...)
+	}
+	if len(blocks) == 1 {
+		header.Content = blocks[0]
+	} else {
+		header.Content = blocks
+	}
+	envelope.Header = header
+	return envelope
+}
+
+// DecryptBody return the envelope in data with each EncryptedData replaced
+// by its plaintext, the session key being unwrapped with key from the
+// first EncryptedKey of the message. data is returned as is when it holds
+// no EncryptedData.
+func DecryptBody(data []byte, key *rsa.PrivateKey) ([]byte, error) {
+	type span struct {
+		start, end int64
+		data       EncryptedData
+	}
+	var (
+		encryptedKey *EncryptedKey
+		spans        []span
+	)
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		offset := d.InputOffset()
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode encrypted SOAP message: %s", err.Error())
+		}
+		se, ok := token.(xml.StartElement)
+		if !ok || se.Name.Space != XMLEncNamespace {
+			continue
+		}
+		switch se.Name.Local {
+		case "EncryptedKey":
+			if encryptedKey != nil {
+				err = d.Skip()
+				break
+			}
+			encryptedKey = &EncryptedKey{}
+			err = d.DecodeElement(encryptedKey, &se)
+		case "EncryptedData":
+			s := span{start: offset}
+			err = d.DecodeElement(&s.data, &se)
+			s.end = d.InputOffset()
+			spans = append(spans, s)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode encrypted SOAP message: %s", err.Error())
+		}
+	}
+	if len(spans) == 0 {
+		return data, nil
+	}
+	if encryptedKey == nil {
+		return nil, errors.New("failed to decrypt SOAP body: no EncryptedKey")
+	}
+	if encryptedKey.EncryptionMethod.Algorithm != RSAOAEP {
+		return nil, fmt.Errorf("failed to decrypt SOAP body: unsupported key transport %s", encryptedKey.EncryptionMethod.Algorithm)
+	}
+	sessionKey, err := rsa.DecryptOAEP(sha1.New(), nil, key, encryptedKey.CipherData.CipherValue, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap session key: %s", err.Error())
+	}
+	plain := make([]byte, 0, len(data))
+	var last int64
+	for _, s := range spans {
+		plaintext, err := decryptData(s.data.EncryptionMethod.Algorithm, sessionKey, s.data.CipherData.CipherValue)
+		if err != nil {
+			return nil, err
+		}
+		plain = append(plain, data[last:s.start]...)
+		plain = append(plain, plaintext...)
+		last = s.end
+	}
+	return append(plain, data[last:]...), nil
+}
+
+// keySize return the session key size of the data encryption algorithm
+func keySize(algorithm string) (int, error) {
+	switch algorithm {
+	case AES128CBC, AES128GCM:
+		return 16, nil
+	case AES256CBC, AES256GCM:
+		return 32, nil
+	}
+	return 0, fmt.Errorf("unsupported encryption algorithm %s", algorithm)
+}
+
+// encryptData encrypt plaintext with key, the IV or nonce prepended as
+// XML Encryption requires
+func encryptData(algorithm string, key, plaintext []byte) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	switch algorithm {
+	case AES128GCM, AES256GCM:
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		nonce := make([]byte, gcm.NonceSize())
+		if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, err
+		}
+		return gcm.Seal(nonce, nonce, plaintext, nil), nil
+	}
+	// ISO 10126 padding: arbitrary bytes, the last one counting them
+	pad := aes.BlockSize - len(plaintext)%aes.BlockSize
+	ciphertext := make([]byte, aes.BlockSize+len(plaintext)+pad)
+	if _, err = io.ReadFull(rand.Reader, ciphertext[:aes.BlockSize]); err != nil {
+		return nil, err
+	}
+	copy(ciphertext[aes.BlockSize:], plaintext)
+	ciphertext[len(ciphertext)-1] = byte(pad)
+	cipher.NewCBCEncrypter(block, ciphertext[:aes.BlockSize]).CryptBlocks(ciphertext[aes.BlockSize:], ciphertext[aes.BlockSize:])
+	return ciphertext, nil
+}
+
+// decryptData reverse encryptData
+func decryptData(algorithm string, key, ciphertext []byte) ([]byte, error) {
+	if _, err := keySize(algorithm); err != nil {
+		return nil, fmt.Errorf("failed to decrypt SOAP body: %s", err.Error())
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt SOAP body: %s", err.Error())
+	}
+	switch algorithm {
+	case AES128GCM, AES256GCM:
+		gcm, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		if len(ciphertext) < gcm.NonceSize() {
+			return nil, errors.New("failed to decrypt SOAP body: truncated cipher data")
+		}
+		plaintext, err := gcm.Open(nil, ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():], nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt SOAP body: %s", err.Error())
+		}
+		return plaintext, nil
+	}
+	if len(ciphertext) < 2*aes.BlockSize || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, errors.New("failed to decrypt SOAP body: truncated cipher data")
+	}
+	plaintext := make([]byte, len(ciphertext)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, ciphertext[:aes.BlockSize]).CryptBlocks(plaintext, ciphertext[aes.BlockSize:])
+	pad := int(plaintext[len(plaintext)-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return nil, errors.New("failed to decrypt SOAP body: invalid padding")
+	}
+	return plaintext[:len(plaintext)-pad], nil
+}
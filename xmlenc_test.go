@@ -0,0 +1,129 @@
+package soap_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/xml"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/sait/soapc"
+)
+
+// newRecipient return an RSA key and a self-signed certificate for it
+func newRecipient(t *testing.T, cn string) (*rsa.PrivateKey, *x509.Certificate) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageKeyEncipherment,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key, cert
+}
+
+func TestClientBodyEncryption(t *testing.T) {
+	serverKey, serverCert := newRecipient(t, "server")
+	clientKey, clientCert := newRecipient(t, "client")
+
+	var received []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		received = data
+		plain, err := DecryptBody(data, serverKey)
+		if err != nil || !bytes.Contains(plain, []byte("<message>secret</message>")) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		response := Envelope{Body: Body{Content: testRequest{Message: "reply"}}}
+		if response, err = EncryptBody(response, clientCert, AES256GCM); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		xml.NewEncoder(w).Encode(response)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, false, NewUsernameToken("user", "pass"),
+		WithBodyEncryption(BodyEncryption{Recipient: serverCert, Key: clientKey}))
+	resp, err := client.Call("", testRequest{Message: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(received, []byte("secret")) {
+		t.Errorf("want body encrypted, got\n%s", received)
+	}
+	if bytes.Count(received, []byte("Security ")) != 1 || !bytes.Contains(received, []byte("UsernameToken")) {
+		t.Errorf("want EncryptedKey merged into the Security block, got\n%s", received)
+	}
+	var reply testRequest
+	if err := DecodeResponse(bytes.NewReader(resp), nil, &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Message != "reply" {
+		t.Errorf("want decrypted reply, got %q in\n%s", reply.Message, resp)
+	}
+
+	_, otherCert := newRecipient(t, "other")
+	client = NewClient(ts.URL, false, nil, WithBodyEncryption(BodyEncryption{Recipient: otherCert}))
+	if _, err := client.Call("", testRequest{Message: "secret"}); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Errorf("want server failing to decrypt, got %v", err)
+	}
+}
+
+func TestClientBodyDecryptionOnly(t *testing.T) {
+	clientKey, clientCert := newRecipient(t, "client")
+
+	var received []byte
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		response, err := EncryptBody(Envelope{Body: Body{Content: testRequest{Message: "reply"}}}, clientCert, AES128GCM)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		xml.NewEncoder(w).Encode(response)
+	}))
+	defer ts.Close()
+
+	client := NewClient(ts.URL, false, nil, WithBodyEncryption(BodyEncryption{Key: clientKey}))
+	resp, err := client.Call("", testRequest{Message: "plain"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(received, []byte("<message>plain</message>")) {
+		t.Errorf("want request sent in the clear, got\n%s", received)
+	}
+	var reply testRequest
+	if err := DecodeResponse(bytes.NewReader(resp), nil, &reply); err != nil || reply.Message != "reply" {
+		t.Errorf("want decrypted reply, got %q: %v in\n%s", reply.Message, err, resp)
+	}
+
+	if _, err := EncryptBody(Envelope{}, nil, ""); err == nil {
+		t.Error("want error encrypting for no recipient")
+	}
+	if _, err := EncryptBody(Envelope{}, &x509.Certificate{PublicKey: &ecdsa.PublicKey{}}, ""); err == nil {
+		t.Error("want error encrypting for a non-RSA recipient")
+	}
+}
@@ -0,0 +1,168 @@
+package soap
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// xsd lexical layouts; fractional seconds and timezone are optional on input
+const (
+	xsdDateTimeLayout = "2006-01-02T15:04:05Z07:00"
+	xsdDateLayout     = "2006-01-02"
+	xsdTimeLayout     = "15:04:05Z07:00"
+)
+
+var (
+	xsdDateTimeParseLayouts = []string{"2006-01-02T15:04:05.999999999Z07:00", "2006-01-02T15:04:05.999999999"}
+	xsdDateParseLayouts     = []string{"2006-01-02Z07:00", "2006-01-02"}
+	xsdTimeParseLayouts     = []string{"15:04:05.999999999Z07:00", "15:04:05.999999999"}
+)
+
+// DateTime xsd:dateTime.
+// Values are emitted in canonical form: UTC, whole seconds, "Z" suffix.
+// Use *DateTime with omitempty for optional elements.
+type DateTime time.Time
+
+// Date xsd:date. Values are emitted as the calendar date in their own location.
+type Date time.Time
+
+// Time xsd:time. Values are emitted in UTC, whole seconds, "Z" suffix.
+type Time time.Time
+
+// MarshalText encode xsd:dateTime
+func (t DateTime) MarshalText() ([]byte, error) {
+	return []byte(time.Time(t).UTC().Format(xsdDateTimeLayout)), nil
+}
+
+// UnmarshalText decode xsd:dateTime; values without timezone are taken as UTC
+func (t *DateTime) UnmarshalText(text []byte) error {
+	v, err := parseXSD(string(text), xsdDateTimeParseLayouts)
+	if err != nil {
+		return err
+	}
+	*t = DateTime(v)
+	return nil
+}
+
+// String return canonical xsd:dateTime
+func (t DateTime) String() string {
+	b, _ := t.MarshalText()
+	return string(b)
+}
+
+// MarshalText encode xsd:date
+func (t Date) MarshalText() ([]byte, error) {
+	return []byte(time.Time(t).Format(xsdDateLayout)), nil
+}
+
+// UnmarshalText decode xsd:date; values without timezone are taken as UTC
+func (t *Date) UnmarshalText(text []byte) error {
+	v, err := parseXSD(string(text), xsdDateParseLayouts)
+	if err != nil {
+		return err
+	}
+	*t = Date(v)
+	return nil
+}
+
+// String return canonical xsd:date
+func (t Date) String() string {
+	b, _ := t.MarshalText()
+	return string(b)
+}
+
+// MarshalText encode xsd:time
+func (t Time) MarshalText() ([]byte, error) {
+	return []byte(time.Time(t).UTC().Format(xsdTimeLayout)), nil
+}
+
+// UnmarshalText decode xsd:time; values without timezone are taken as UTC
+func (t *Time) UnmarshalText(text []byte) error {
+	v, err := parseXSD(string(text), xsdTimeParseLayouts)
+	if err != nil {
+		return err
+	}
+	*t = Time(v)
+	return nil
+}
+
+// String return canonical xsd:time
+func (t Time) String() string {
+	b, _ := t.MarshalText()
+	return string(b)
+}
+
+// Base64Binary xsd:base64Binary. Unlike a plain []byte, which encoding/xml
+// treats as text, the content is base64 encoded and decoded, including
+// MTOM attachments inlined from xop:Include references. Whitespace, as
+// line-wrapped encoders emit, is ignored when decoding. Both nil and empty
+// values are omitted by omitempty; use *Base64Binary to send an empty
+// element for an empty non-nil value. Decoding an empty element gives an
+// empty non-nil value, leaving an absent one nil.
+type Base64Binary []byte
+
+// MarshalText encode xsd:base64Binary
+func (b Base64Binary) MarshalText() ([]byte, error) {
+	text := make([]byte, base64.StdEncoding.EncodedLen(len(b)))
+	base64.StdEncoding.Encode(text, b)
+	return text, nil
+}
+
+// UnmarshalText decode xsd:base64Binary
+func (b *Base64Binary) UnmarshalText(text []byte) error {
+	text = stripSpace(text)
+	data := make([]byte, base64.StdEncoding.DecodedLen(len(text)))
+	n, err := base64.StdEncoding.Decode(data, text)
+	if err != nil {
+		return fmt.Errorf("failed to decode xsd:base64Binary: %s", err.Error())
+	}
+	*b = data[:n]
+	return nil
+}
+
+// HexBinary xsd:hexBinary, handled as Base64Binary is. Values are
+// emitted in canonical upper case; either case is accepted.
+type HexBinary []byte
+
+// MarshalText encode xsd:hexBinary
+func (b HexBinary) MarshalText() ([]byte, error) {
+	return bytes.ToUpper([]byte(hex.EncodeToString(b))), nil
+}
+
+// UnmarshalText decode xsd:hexBinary
+func (b *HexBinary) UnmarshalText(text []byte) error {
+	text = stripSpace(text)
+	data := make([]byte, hex.DecodedLen(len(text)))
+	if _, err := hex.Decode(data, text); err != nil {
+		return fmt.Errorf("failed to decode xsd:hexBinary: %s", err.Error())
+	}
+	*b = data
+	return nil
+}
+
+// stripSpace return text without XML whitespace
+func stripSpace(text []byte) []byte {
+	if bytes.IndexAny(text, " \t\r\n") < 0 {
+		return text
+	}
+	return bytes.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n':
+			return -1
+		}
+		return r
+	}, text)
+}
+
+func parseXSD(value string, layouts []string) (t time.Time, err error) {
+	for _, layout := range layouts {
+		if t, err = time.Parse(layout, value); err == nil {
+			return
+		}
+	}
+	err = fmt.Errorf("failed to parse xsd value %q: %s", value, err.Error())
+	return
+}
@@ -0,0 +1,114 @@
+package soap_test
+
+import (
+	"encoding/xml"
+	"testing"
+	"time"
+
+	. "github.com/sait/soapc"
+)
+
+type xsdTimes struct {
+	XMLName  xml.Name  `xml:"times"`
+	DateTime DateTime  `xml:"dateTime"`
+	Date     Date      `xml:"date"`
+	Time     Time      `xml:"time"`
+	Optional *DateTime `xml:"optional,omitempty"`
+	Attr     DateTime  `xml:"at,attr"`
+}
+
+func TestXSDMarshal(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	ts := time.Date(2017, 3, 1, 9, 30, 15, 123456789, jst)
+	v := xsdTimes{
+		DateTime: DateTime(ts),
+		Date:     Date(ts),
+		Time:     Time(ts),
+		Attr:     DateTime(ts),
+	}
+	b, err := xml.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<times at="2017-03-01T00:30:15Z">` +
+		`<dateTime>2017-03-01T00:30:15Z</dateTime>` +
+		`<date>2017-03-01</date>` +
+		`<time>00:30:15Z</time>` +
+		`</times>`
+	if string(b) != expected {
+		t.Errorf("want %s, got %s", expected, b)
+	}
+}
+
+func TestXSDUnmarshal(t *testing.T) {
+	data := `<times at="2017-03-01T09:30:15+09:00">` +
+		`<dateTime>2017-03-01T09:30:15.5+09:00</dateTime>` +
+		`<date>2017-03-01</date>` +
+		`<time>09:30:15</time>` +
+		`<optional>2017-03-01T00:30:15</optional>` +
+		`</times>`
+	var v xsdTimes
+	if err := xml.Unmarshal([]byte(data), &v); err != nil {
+		t.Fatal(err)
+	}
+	expected := time.Date(2017, 3, 1, 0, 30, 15, 500000000, time.UTC)
+	if !time.Time(v.DateTime).Equal(expected) {
+		t.Errorf("want %s, got %s", expected, time.Time(v.DateTime))
+	}
+	if v.Date.String() != "2017-03-01" {
+		t.Errorf("want 2017-03-01, got %s", v.Date)
+	}
+	if v.Time.String() != "09:30:15Z" {
+		t.Errorf("want 09:30:15Z, got %s", v.Time)
+	}
+	if v.Optional == nil || v.Optional.String() != "2017-03-01T00:30:15Z" {
+		t.Errorf("want optional 2017-03-01T00:30:15Z, got %v", v.Optional)
+	}
+	if v.Attr.String() != "2017-03-01T00:30:15Z" {
+		t.Errorf("want attr 2017-03-01T00:30:15Z, got %s", v.Attr)
+	}
+
+	if err := xml.Unmarshal([]byte(`<times><date>March 1</date></times>`), &v); err == nil {
+		t.Error("want error for invalid xsd:date")
+	}
+}
+
+type xsdBinary struct {
+	XMLName  xml.Name      `xml:"binary"`
+	Base64   Base64Binary  `xml:"base64,omitempty"`
+	Hex      HexBinary     `xml:"hex,omitempty"`
+	Optional *Base64Binary `xml:"optional,omitempty"`
+}
+
+func TestXSDBinary(t *testing.T) {
+	empty := Base64Binary{}
+	v := xsdBinary{
+		Base64:   Base64Binary("hello, world"),
+		Hex:      HexBinary{0xca, 0xfe, 0x01},
+		Optional: &empty,
+	}
+	b, err := xml.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `<binary><base64>aGVsbG8sIHdvcmxk</base64><hex>CAFE01</hex><optional></optional></binary>`
+	if string(b) != expected {
+		t.Errorf("want %s, got %s", expected, b)
+	}
+
+	data := "<binary><base64>aGVsbG8s\n  IHdvcmxk</base64><hex>cafe01</hex><optional/></binary>"
+	var decoded xsdBinary
+	if err := xml.Unmarshal([]byte(data), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if string(decoded.Base64) != "hello, world" || string(decoded.Hex) != "\xca\xfe\x01" {
+		t.Errorf("unexpected values %q %x", decoded.Base64, decoded.Hex)
+	}
+	if decoded.Optional == nil || *decoded.Optional == nil || len(*decoded.Optional) != 0 {
+		t.Errorf("want empty non-nil optional, got %v", decoded.Optional)
+	}
+
+	if err := xml.Unmarshal([]byte(`<binary><hex>CAF</hex></binary>`), &decoded); err == nil {
+		t.Error("want error for invalid xsd:hexBinary")
+	}
+}
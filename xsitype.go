@@ -0,0 +1,111 @@
+package soap
+
+import (
+	"encoding/xml"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// XSINamespace XML Schema instance namespace
+const XSINamespace = "http://www.w3.org/2001/XMLSchema-instance"
+
+var xsiTypes = struct {
+	sync.RWMutex
+	m map[xml.Name]reflect.Type
+}{m: map[xml.Name]reflect.Type{}}
+
+// RegisterXSIType decode XSITyped elements whose xsi:type is name into
+// values of prototype's type, e.g. RegisterXSIType(name, Circle{})
+func RegisterXSIType(name xml.Name, prototype interface{}) {
+	t := reflect.TypeOf(prototype)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	xsiTypes.Lock()
+	defer xsiTypes.Unlock()
+	xsiTypes.m[name] = t
+}
+
+// lookupXSIType return the type registered for name. When the namespace of
+// name could not be resolved, a type registered under its local name alone
+// in a single namespace is returned.
+func lookupXSIType(name xml.Name) (xml.Name, reflect.Type, bool) {
+	xsiTypes.RLock()
+	defer xsiTypes.RUnlock()
+	if t, ok := xsiTypes.m[name]; ok || name.Space != "" {
+		return name, t, ok
+	}
+	var (
+		found xml.Name
+		t     reflect.Type
+	)
+	for n, nt := range xsiTypes.m {
+		if n.Local == name.Local {
+			if t != nil {
+				return name, nil, false
+			}
+			found, t = n, nt
+		}
+	}
+	return found, t, t != nil
+}
+
+// XSITyped element of an abstract schema type, decoded into the Go type
+// registered with RegisterXSIType for its xsi:type and encoded with
+// Type as xsi:type
+type XSITyped struct {
+	// Type xsi:type of the element
+	Type xml.Name
+	// V concrete value, a pointer to the registered type once decoded
+	V interface{}
+}
+
+// MarshalXML encode V with an xsi:type attribute naming Type
+func (x XSITyped) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	if x.Type.Local != "" {
+		value := x.Type.Local
+		if x.Type.Space != "" {
+			start.Attr = append(start.Attr, xml.Attr{Name: xml.Name{Local: "xmlns:xt"}, Value: x.Type.Space})
+			value = "xt:" + value
+		}
+		start.Attr = append(start.Attr,
+			xml.Attr{Name: xml.Name{Local: "xmlns:xsi"}, Value: XSINamespace},
+			xml.Attr{Name: xml.Name{Local: "xsi:type"}, Value: value})
+	}
+	return e.EncodeElement(x.V, start)
+}
+
+// UnmarshalXML decode into a new value of the type registered for the
+// element's xsi:type. Its prefix is resolved against the declarations of
+// the element itself, as encoding/xml does not expose those of ancestors;
+// failing that, the type is looked up by local name.
+func (x *XSITyped) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	var qname string
+	for _, attr := range start.Attr {
+		if attr.Name.Space == XSINamespace && attr.Name.Local == "type" {
+			qname = strings.TrimSpace(attr.Value)
+		}
+	}
+	if qname == "" {
+		return xml.UnmarshalError("element <" + start.Name.Local + "> has no xsi:type")
+	}
+	name := xml.Name{Local: qname}
+	prefix := ""
+	if i := strings.Index(qname, ":"); i >= 0 {
+		prefix, name.Local = qname[:i], qname[i+1:]
+	}
+	name.Space = namespaces(nil).with(start.Attr)[prefix]
+
+	name, t, ok := lookupXSIType(name)
+	if !ok {
+		return xml.UnmarshalError("no Go type registered for xsi:type " + qname)
+	}
+	v := reflect.New(t)
+	if err := d.DecodeElement(v.Interface(), &start); err != nil {
+		return err
+	}
+	x.Type = name
+	x.V = v.Interface()
+	return nil
+}
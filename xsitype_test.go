@@ -0,0 +1,73 @@
+package soap_test
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	. "github.com/sait/soapc"
+)
+
+type xsiCircle struct {
+	Radius float64 `xml:"radius"`
+}
+
+type xsiSquare struct {
+	Side float64 `xml:"side"`
+}
+
+type xsiDrawing struct {
+	XMLName xml.Name   `xml:"drawing"`
+	Shapes  []XSITyped `xml:"shape"`
+}
+
+func init() {
+	RegisterXSIType(xml.Name{Space: "urn:shapes", Local: "Circle"}, xsiCircle{})
+	RegisterXSIType(xml.Name{Space: "urn:shapes", Local: "Square"}, &xsiSquare{})
+}
+
+func TestXSITypeDecode(t *testing.T) {
+	data := `<drawing xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xmlns:s="urn:shapes">
+  <shape xmlns:t="urn:shapes" xsi:type="t:Circle"><radius>1.5</radius></shape>
+  <shape xsi:type="s:Square"><side>2</side></shape>
+</drawing>`
+	var drawing xsiDrawing
+	if err := xml.Unmarshal([]byte(data), &drawing); err != nil {
+		t.Fatal(err)
+	}
+	if len(drawing.Shapes) != 2 {
+		t.Fatalf("want 2 shapes, got %d", len(drawing.Shapes))
+	}
+	if c, ok := drawing.Shapes[0].V.(*xsiCircle); !ok || c.Radius != 1.5 {
+		t.Errorf("want circle, got %#v", drawing.Shapes[0].V)
+	}
+	// prefix declared on an ancestor, resolved by local name
+	if s, ok := drawing.Shapes[1].V.(*xsiSquare); !ok || s.Side != 2 {
+		t.Errorf("want square, got %#v", drawing.Shapes[1].V)
+	}
+	if want := (xml.Name{Space: "urn:shapes", Local: "Square"}); drawing.Shapes[1].Type != want {
+		t.Errorf("want type %v, got %v", want, drawing.Shapes[1].Type)
+	}
+
+	err := xml.Unmarshal([]byte(`<drawing xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance"><shape xsi:type="Triangle"/></drawing>`), &drawing)
+	if err == nil || !strings.Contains(err.Error(), "Triangle") {
+		t.Errorf("want unregistered type error, got %v", err)
+	}
+}
+
+func TestXSITypeEncode(t *testing.T) {
+	drawing := xsiDrawing{Shapes: []XSITyped{
+		{Type: xml.Name{Space: "urn:shapes", Local: "Circle"}, V: xsiCircle{Radius: 1.5}},
+	}}
+	b, err := xml.Marshal(drawing)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded xsiDrawing
+	if err := xml.Unmarshal(b, &decoded); err != nil {
+		t.Fatalf("%s\n%s", err, b)
+	}
+	if c, ok := decoded.Shapes[0].V.(*xsiCircle); !ok || c.Radius != 1.5 {
+		t.Errorf("want circle to round trip, got %#v from %s", decoded.Shapes[0].V, b)
+	}
+}